@@ -0,0 +1,555 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	// sqlite driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nicday/turtle/config"
+	"github.com/nicday/turtle/db"
+	"github.com/nicday/turtle/migration"
+)
+
+// exitPending is the exit code of the status command when there are pending migrations.
+const exitPending = 3
+
+// setFlag selects one of the migration sets in MIGRATION_SETS.
+var setFlag = cli.StringFlag{
+	Name:  "set",
+	Usage: "the migration set from MIGRATION_SETS to use, instead of all of them",
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "turtle"
+	app.Usage = "for incredible (SQL) migrations, just the sea turtle!"
+	app.Version = config.Version
+
+	app.Commands = []cli.Command{
+		cli.Command{
+			Name:    "generate",
+			Aliases: []string{"g"},
+			Usage:   "Generates a new set of migration files",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "single",
+					Usage: "generate a single file with up and down sections",
+				},
+				cli.StringFlag{
+					Name:  "template",
+					Usage: "render the SQL from a template: create_table, add_column, add_index or one in TEMPLATES_PATH",
+				},
+				cli.StringFlag{
+					Name:  "table",
+					Usage: "the table passed to the template",
+				},
+				cli.StringSliceFlag{
+					Name:  "column",
+					Usage: "a name:type column passed to the template, can be repeated",
+				},
+				cli.StringFlag{
+					Name:  "id-scheme",
+					Usage: "number the migration with a `timestamp`, `utc` timestamp or `sequential` number, instead of ID_SCHEME",
+				},
+				setFlag,
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) == 0 {
+					fmt.Println("Please call with a migration name, e.g. `turtle generate users`")
+					return
+				}
+				if len(c.Args()) != 0 {
+					migrationName := c.Args()[0]
+					loadEnv()
+					useSet(c)
+
+					columns := []migration.Column{}
+					for _, column := range c.StringSlice("column") {
+						columns = append(columns, migration.ParseColumn(column))
+					}
+
+					err := migration.GenerateWith(migrationName, migration.GenerateOptions{
+						Single:   c.Bool("single"),
+						Template: c.String("template"),
+						Table:    c.String("table"),
+						Columns:  columns,
+						IDScheme: c.String("id-scheme"),
+					})
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+			},
+		},
+		cli.Command{
+			Name:    "create",
+			Aliases: []string{"c"},
+			Usage:   "Creates the database on the host",
+			Action: func(c *cli.Context) {
+				db.InitMaintenanceConnection()
+				migration.CreateDB()
+			},
+		},
+		cli.Command{
+			Name:    "drop",
+			Aliases: []string{"c"},
+			Usage:   "Drops the database on the host",
+			Action: func(c *cli.Context) {
+				db.InitMaintenanceConnection()
+				migration.DropDB()
+			},
+		},
+		cli.Command{
+			Name:    "up",
+			Aliases: []string{"u"},
+			Usage:   "Processes all outstanding migrations",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the migrations and their SQL without running them",
+				},
+				cli.StringFlag{
+					Name:  "transaction",
+					Usage: "`all` applies the pending migrations in a single transaction, instead of one per migration",
+				},
+				cli.StringFlag{
+					Name:  "out-of-order",
+					Usage: "`fail`, `warn` or `allow` pending migrations older than the latest applied migration",
+				},
+				setFlag,
+			},
+			Action: func(c *cli.Context) {
+				db.InitConnection()
+				db.UseDB()
+				setTransactionMode(c)
+				setOutOfOrder(c)
+				if c.Bool("dry-run") {
+					err := eachSet(c, false, migration.DryRunApplyAll)
+					if err != nil {
+						os.Exit(1)
+					}
+					return
+				}
+				runMigrations(func() error {
+					if combined(c) {
+						return migration.ApplyAllSets()
+					}
+					return eachSet(c, false, migration.ApplyAll)
+				})
+			},
+		},
+		cli.Command{
+			Name:    "down",
+			Aliases: []string{"d"},
+			Usage:   "Reverts all applied migrations",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the migrations and their SQL without running them",
+				},
+				setFlag,
+			},
+			Action: func(c *cli.Context) {
+				db.InitConnection()
+				db.UseDB()
+				if c.Bool("dry-run") {
+					err := eachSet(c, true, migration.DryRunRevertAll)
+					if err != nil {
+						os.Exit(1)
+					}
+					return
+				}
+				runMigrations(func() error {
+					if combined(c) {
+						return migration.RevertAllSets()
+					}
+					return eachSet(c, true, migration.RevertAll)
+				})
+			},
+		},
+		cli.Command{
+			Name:    "rollback",
+			Aliases: []string{"r"},
+			Usage:   "Rollback n active migrations",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the migrations and their SQL without running them",
+				},
+				setFlag,
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) == 0 {
+					fmt.Println("Please call with a number of migrations to rollback, e.g. `turtle rollback 3`")
+					return
+				}
+				if len(c.Args()) != 0 {
+					n, err := strconv.Atoi(c.Args()[0])
+					if err != nil {
+						log.Fatal("[Error] Rollback parameter is not an integer")
+					}
+					db.InitConnection()
+					db.UseDB()
+					useSet(c)
+					if c.Bool("dry-run") {
+						err := migration.DryRunRollback(n)
+						if err != nil {
+							os.Exit(1)
+						}
+						return
+					}
+					runMigrations(func() error { return migration.Rollback(n) })
+				}
+			},
+		},
+		cli.Command{
+			Name:    "migrate",
+			Aliases: []string{"m"},
+			Usage:   "Applies or reverts migrations until the target migration is the latest active migration",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "the target migration ID or version",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the migrations and their SQL without running them",
+				},
+				cli.StringFlag{
+					Name:  "transaction",
+					Usage: "`all` applies the pending migrations in a single transaction, instead of one per migration",
+				},
+				cli.StringFlag{
+					Name:  "out-of-order",
+					Usage: "`fail`, `warn` or `allow` pending migrations older than the latest applied migration",
+				},
+				setFlag,
+			},
+			Action: func(c *cli.Context) {
+				target := c.String("to")
+				if target == "" {
+					fmt.Println("Please call with a target migration, e.g. `turtle migrate --to 20150703234300001`")
+					return
+				}
+				db.InitConnection()
+				db.UseDB()
+				useSet(c)
+				setTransactionMode(c)
+				setOutOfOrder(c)
+				if c.Bool("dry-run") {
+					err := migration.DryRunMigrateTo(target)
+					if err != nil {
+						os.Exit(1)
+					}
+					return
+				}
+				runMigrations(func() error { return migration.MigrateTo(target) })
+			},
+		},
+		cli.Command{
+			Name:  "script",
+			Usage: "Writes the SQL for applying (up) or reverting (down) migrations, without running it",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "from",
+					Usage: "the migration ID or version the database is at",
+				},
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "the migration ID or version the database should be at after the script",
+				},
+				cli.StringFlag{
+					Name:  "transaction",
+					Usage: "`migration` wraps each migration in BEGIN and COMMIT, `all` wraps the whole script in one transaction",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "the file to write the script to, instead of stdout",
+				},
+				setFlag,
+			},
+			Action: func(c *cli.Context) {
+				if len(c.Args()) == 0 || (c.Args()[0] != "up" && c.Args()[0] != "down") {
+					fmt.Println("Please call with a direction, e.g. `turtle script up --from 20150703234300001`")
+					return
+				}
+
+				// The script isn't run against the database, so the connection settings aren't required.
+				loadEnv()
+				useSet(c)
+
+				var err error
+				out := os.Stdout
+				if path := c.String("output"); path != "" {
+					out, err = os.Create(path)
+					if err != nil {
+						log.Fatal(err)
+					}
+					defer out.Close()
+				}
+
+				err = migration.WriteScript(out, c.Args()[0], migration.ScriptOptions{
+					From:        c.String("from"),
+					To:          c.String("to"),
+					Transaction: c.String("transaction"),
+				})
+				if err != nil {
+					os.Exit(1)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "schema",
+			Usage: "Writes the schema file (dump) or loads it into a fresh database, marking its migrations as applied (load)",
+			Action: func(c *cli.Context) {
+				if len(c.Args()) == 0 || (c.Args()[0] != "dump" && c.Args()[0] != "load") {
+					fmt.Println("Please call with dump or load, e.g. `turtle schema load`")
+					return
+				}
+				db.InitConnection()
+				db.UseDB()
+				if len(config.MigrationSets) > 0 {
+					log.Fatal("[Error] the schema file can't be used with MIGRATION_SETS")
+				}
+				var err error
+				if c.Args()[0] == "dump" {
+					err = migration.DumpSchema()
+				} else {
+					err = migration.LoadSchema()
+				}
+				if err != nil {
+					os.Exit(1)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "lint",
+			Usage: "Checks the migration files for problems, exiting with status 1 if any are found",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "offline",
+					Usage: "only check the files, skipping the checks against the applied migrations",
+				},
+				setFlag,
+			},
+			Action: func(c *cli.Context) {
+				offline := c.Bool("offline")
+				if offline {
+					loadEnv()
+				} else {
+					db.InitConnection()
+					db.UseDB()
+				}
+				issues := 0
+				err := eachSet(c, false, func() error {
+					n, err := migration.Lint(os.Stdout, offline)
+					issues += n
+					return err
+				})
+				if err != nil {
+					log.Fatal(err)
+				}
+				if issues > 0 {
+					os.Exit(1)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "validate",
+			Usage: "Checks that applied migrations haven't changed since they were applied",
+			Flags: []cli.Flag{setFlag},
+			Action: func(c *cli.Context) {
+				db.InitConnection()
+				db.UseDB()
+				err := eachSet(c, false, migration.Validate)
+				if err != nil {
+					os.Exit(1)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "repair",
+			Usage: "Accepts changes to applied migrations by updating their recorded checksums",
+			Flags: []cli.Flag{setFlag},
+			Action: func(c *cli.Context) {
+				db.InitConnection()
+				db.UseDB()
+				err := eachSet(c, false, migration.Repair)
+				if err != nil {
+					os.Exit(1)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "unlock",
+			Usage: "Clears a stale migration lock, left by a migration that didn't finish",
+			Flags: []cli.Flag{setFlag},
+			Action: func(c *cli.Context) {
+				db.InitConnection()
+				db.UseDB()
+				err := eachSet(c, false, db.ForceUnlock)
+				if err != nil {
+					log.Fatal(err)
+				}
+			},
+		},
+		cli.Command{
+			Name:    "status",
+			Aliases: []string{"s"},
+			Usage:   "Lists applied and pending migrations, exiting with status 3 if any are pending",
+			Flags:   []cli.Flag{setFlag},
+			Action: func(c *cli.Context) {
+				db.InitConnection()
+				db.UseDB()
+				pending := 0
+				err := eachSet(c, false, func() error {
+					summary, err := migration.PrintStatus(os.Stdout)
+					pending += summary[migration.StatePending]
+					return err
+				})
+				if err != nil {
+					log.Fatal(err)
+				}
+				if pending > 0 {
+					os.Exit(exitPending)
+				}
+			},
+		},
+	}
+
+	app.Run(os.Args)
+}
+
+// loadEnv initializes the environment for commands that don't connect to the database, so the connection settings
+// aren't required.
+func loadEnv() {
+	err := config.InitEnv()
+	if err != nil && err != config.ErrNoDBHost && err != config.ErrNoDBName && err != config.ErrNoDBPath {
+		log.Fatal(err)
+	}
+}
+
+// useSet selects the migration set given with --set. Commands that act on a single migration set exit if
+// MIGRATION_SETS is set without --set.
+func useSet(c *cli.Context) {
+	name := c.String("set")
+	if name == "" {
+		if len(config.MigrationSets) > 0 {
+			log.Fatal("[Error] MIGRATION_SETS is set, please choose a migration set with --set")
+		}
+		return
+	}
+
+	err := config.UseMigrationSet(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// eachSet runs fn for the migration set given with --set, or for each of MIGRATION_SETS in turn, stopping at the first
+// error. The sets are taken in reverse when reverting migrations.
+func eachSet(c *cli.Context, reverse bool, fn func() error) error {
+	if c.String("set") != "" || len(config.MigrationSets) == 0 {
+		useSet(c)
+		return fn()
+	}
+
+	sets := append([]config.MigrationSet{}, config.MigrationSets...)
+	if reverse {
+		for i, j := 0, len(sets)-1; i < j; i, j = i+1, j-1 {
+			sets[i], sets[j] = sets[j], sets[i]
+		}
+	}
+
+	for _, set := range sets {
+		fmt.Printf("== %s\n", set.Name)
+		config.UseMigrationSet(set.Name)
+		err := fn()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// combined returns true if the migrations of all the sets are run in a single order, because SET_ORDER is combined
+// and no set was chosen with --set.
+func combined(c *cli.Context) bool {
+	return config.SetOrder == config.SetOrderCombined && len(config.MigrationSets) > 0 && c.String("set") == ""
+}
+
+// runMigrations runs fn, then writes the schema file if any migration was applied or reverted, including when fn
+// fails part way through, so that the schema file matches the database. It exits with an error if fn failed.
+func runMigrations(fn func() error) {
+	before := appliedIDs()
+	err := fn()
+	if appliedIDs() != before {
+		dumpSchema()
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// appliedIDs returns the IDs of the applied migrations, joined by commas, when the schema file is written. It is empty
+// when the migrations table can't be read, e.g. before it's created.
+func appliedIDs() string {
+	if !schemaDumped() {
+		return ""
+	}
+
+	records, err := db.DefaultLog().Applied(context.Background())
+	if err != nil {
+		return ""
+	}
+
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// schemaDumped returns true if the schema file is written after a migration run, unless SCHEMA_DUMP is false or
+// migration sets are used, since the schema file only records the migrations of one migrations table.
+func schemaDumped() bool {
+	return config.SchemaDump && len(config.MigrationSets) == 0
+}
+
+// dumpSchema writes the schema file after a migration run. The migration has already run, so a failure is only logged.
+func dumpSchema() {
+	if schemaDumped() {
+		migration.DumpSchema()
+	}
+}
+
+// setOutOfOrder overrides OUT_OF_ORDER with the --out-of-order flag, if it was given.
+func setOutOfOrder(c *cli.Context) {
+	policy := c.String("out-of-order")
+	if policy == "" {
+		return
+	}
+	if policy != config.OutOfOrderFail && policy != config.OutOfOrderWarn && policy != config.OutOfOrderAllow {
+		log.Fatal(config.ErrInvalidOutOfOrder)
+	}
+	config.OutOfOrder = policy
+}
+
+// setTransactionMode overrides TRANSACTION_MODE with the --transaction flag, if it was given.
+func setTransactionMode(c *cli.Context) {
+	mode := c.String("transaction")
+	if mode == "" {
+		return
+	}
+	if mode != config.TransactionPerMigration && mode != config.TransactionAll {
+		log.Fatal(config.ErrInvalidTransactionMode)
+	}
+	config.TransactionMode = mode
+}
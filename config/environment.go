@@ -3,6 +3,9 @@ package config
 import (
 	"errors"
 	"os"
+	"path"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -10,8 +13,49 @@ import (
 const (
 	defaultMigrationsTableName = "migrations"
 	defaultMigrationsPath      = "migrations"
+	defaultDBDriver            = "mysql"
 	defaultDBPort              = "3306"
 	defaultDBUser              = "root"
+	defaultPostgresDBPort      = "5432"
+	defaultPostgresDBUser      = "postgres"
+	defaultLockTimeout         = time.Minute
+	defaultTransactionMode     = TransactionPerMigration
+	defaultOutOfOrder          = OutOfOrderFail
+	defaultSchemaPath          = "schema.sql"
+	defaultIDScheme            = IDSchemeTimestamp
+	defaultIDPadding           = 4
+)
+
+const (
+	// TransactionPerMigration runs each migration in its own transaction.
+	TransactionPerMigration = "migration"
+
+	// TransactionAll runs all the pending migrations of an up run in a single transaction.
+	TransactionAll = "all"
+)
+
+const (
+	// OutOfOrderFail refuses to apply pending migrations older than the latest applied migration.
+	OutOfOrderFail = "fail"
+
+	// OutOfOrderWarn applies pending migrations older than the latest applied migration, reporting them as out of order.
+	OutOfOrderWarn = "warn"
+
+	// OutOfOrderAllow applies pending migrations older than the latest applied migration like any other.
+	OutOfOrderAllow = "allow"
+)
+
+const (
+	// IDSchemeTimestamp prefixes generated migrations with the local time to the millisecond, e.g. 20150703234300001.
+	IDSchemeTimestamp = "timestamp"
+
+	// IDSchemeUTC prefixes generated migrations with the UTC time to the millisecond, so that IDs don't depend on the
+	// time zone of whoever generated them.
+	IDSchemeUTC = "utc"
+
+	// IDSchemeSequential prefixes generated migrations with the next number after the latest migration, zero padded to
+	// IDPadding digits, e.g. 0001.
+	IDSchemeSequential = "sequential"
 )
 
 var (
@@ -21,8 +65,36 @@ var (
 	// MigrationsPath is the location that migration files will loaded from the filesystem.
 	MigrationsPath = defaultMigrationsPath
 
-	// DBDriver is the driver to use when interfacing with the database.
-	DBDriver string
+	// TemplatesPath is the location of the project's migration templates, used by generate. It defaults to a
+	// `templates` directory in MigrationsPath.
+	TemplatesPath = path.Join(defaultMigrationsPath, "templates")
+
+	// SchemaPath is the location of the schema file written after each migration run and read by `schema load`.
+	SchemaPath = defaultSchemaPath
+
+	// SchemaDump is false if the schema file shouldn't be written after each migration run.
+	SchemaDump = true
+
+	// IDScheme is how generated migrations are numbered, either IDSchemeTimestamp, IDSchemeUTC or IDSchemeSequential.
+	IDScheme = defaultIDScheme
+
+	// IDPadding is the number of digits sequential IDs are zero padded to.
+	IDPadding = defaultIDPadding
+
+	// LockTimeout is how long to wait for another process to release the migration lock.
+	LockTimeout = defaultLockTimeout
+
+	// TransactionMode is how migrations are grouped into transactions, either TransactionPerMigration or
+	// TransactionAll.
+	TransactionMode = defaultTransactionMode
+
+	// OutOfOrder is the policy for pending migrations older than the latest applied migration, usually added on a
+	// branch that merged after a newer migration was applied. Either OutOfOrderFail, OutOfOrderWarn or OutOfOrderAllow.
+	OutOfOrder = defaultOutOfOrder
+
+	// DBDriver is the driver to use when interfacing with the database. It selects the dialect registered in the db
+	// package.
+	DBDriver = defaultDBDriver
 
 	// DBHost is the host address when the database is running.
 	DBHost string
@@ -39,14 +111,38 @@ var (
 	// DBPassword is the password to use for the database user.
 	DBPassword string
 
-	// ErrUnknownDBDriver is raised when the database driver is not `mysql` or `postgres`
-	ErrUnknownDBDriver = errors.New("DB_DRIVER is unknown, must be either `mysql` or `postgres`")
+	// DBPath is the location of the database file for file backed drivers, such as sqlite.
+	DBPath string
+
+	// ErrUnknownDBDriver is raised when there is no dialect registered for the database driver
+	ErrUnknownDBDriver = errors.New("DB_DRIVER is unknown, no dialect is registered for it")
 
 	// ErrNoDBHost is raised when there is no DB_HOST in the environment variables
 	ErrNoDBHost = errors.New("DB_HOST not found in environment variables")
 
 	// ErrNoDBName is raised when there is no DB_NAME in the environment variables
 	ErrNoDBName = errors.New("DB_NAME not found in environment variables")
+
+	// ErrInvalidLockTimeout is raised when LOCK_TIMEOUT isn't a duration, e.g. `30s`
+	ErrInvalidLockTimeout = errors.New("LOCK_TIMEOUT must be a duration, e.g. `30s`")
+
+	// ErrInvalidSchemaDump is raised when SCHEMA_DUMP isn't a boolean, e.g. `false`
+	ErrInvalidSchemaDump = errors.New("SCHEMA_DUMP must be a boolean, e.g. `false`")
+
+	// ErrInvalidTransactionMode is raised when TRANSACTION_MODE isn't `migration` or `all`
+	ErrInvalidTransactionMode = errors.New("TRANSACTION_MODE must be `migration` or `all`")
+
+	// ErrInvalidOutOfOrder is raised when OUT_OF_ORDER isn't `fail`, `warn` or `allow`
+	ErrInvalidOutOfOrder = errors.New("OUT_OF_ORDER must be `fail`, `warn` or `allow`")
+
+	// ErrInvalidIDScheme is raised when ID_SCHEME isn't `timestamp`, `utc` or `sequential`
+	ErrInvalidIDScheme = errors.New("ID_SCHEME must be `timestamp`, `utc` or `sequential`")
+
+	// ErrInvalidIDPadding is raised when ID_PADDING isn't a positive integer
+	ErrInvalidIDPadding = errors.New("ID_PADDING must be a positive integer, e.g. `4`")
+
+	// ErrNoDBPath is raised when there is no DB_PATH in the environment variables for a file backed driver
+	ErrNoDBPath = errors.New("DB_PATH not found in environment variables")
 )
 
 // InitEnv initializes the environment variables. An attempt will be made to load variables from a `.env`, this can
@@ -69,7 +165,102 @@ func InitEnv() error {
 		MigrationsPath = defaultMigrationsPath
 	}
 
+	MigrationSets = nil
+	CurrentMigrationSet = ""
+	if sets := os.Getenv("MIGRATION_SETS"); sets != "" {
+		var err error
+		MigrationSets, err = ParseMigrationSets(sets, MigrationsTableName)
+		if err != nil {
+			return err
+		}
+	}
+
+	SetOrder = os.Getenv("SET_ORDER")
+	switch SetOrder {
+	case "":
+		SetOrder = SetOrderSet
+	case SetOrderSet, SetOrderCombined:
+	default:
+		return ErrInvalidSetOrder
+	}
+
+	TemplatesPath = os.Getenv("TEMPLATES_PATH")
+	if TemplatesPath == "" {
+		TemplatesPath = path.Join(MigrationsPath, "templates")
+	}
+
+	SchemaPath = os.Getenv("SCHEMA_PATH")
+	if SchemaPath == "" {
+		SchemaPath = defaultSchemaPath
+	}
+
+	SchemaDump = true
+	if dump := os.Getenv("SCHEMA_DUMP"); dump != "" {
+		d, err := strconv.ParseBool(dump)
+		if err != nil {
+			return ErrInvalidSchemaDump
+		}
+		SchemaDump = d
+	}
+
+	IDScheme = os.Getenv("ID_SCHEME")
+	switch IDScheme {
+	case "":
+		IDScheme = defaultIDScheme
+	case IDSchemeTimestamp, IDSchemeUTC, IDSchemeSequential:
+	default:
+		return ErrInvalidIDScheme
+	}
+
+	IDPadding = defaultIDPadding
+	if padding := os.Getenv("ID_PADDING"); padding != "" {
+		n, err := strconv.Atoi(padding)
+		if err != nil || n < 1 {
+			return ErrInvalidIDPadding
+		}
+		IDPadding = n
+	}
+
+	LockTimeout = defaultLockTimeout
+	if timeout := os.Getenv("LOCK_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return ErrInvalidLockTimeout
+		}
+		LockTimeout = d
+	}
+
+	TransactionMode = os.Getenv("TRANSACTION_MODE")
+	switch TransactionMode {
+	case "":
+		TransactionMode = defaultTransactionMode
+	case TransactionPerMigration, TransactionAll:
+	default:
+		return ErrInvalidTransactionMode
+	}
+
+	OutOfOrder = os.Getenv("OUT_OF_ORDER")
+	switch OutOfOrder {
+	case "":
+		OutOfOrder = defaultOutOfOrder
+	case OutOfOrderFail, OutOfOrderWarn, OutOfOrderAllow:
+	default:
+		return ErrInvalidOutOfOrder
+	}
+
 	DBDriver = os.Getenv("DB_DRIVER")
+	if DBDriver == "" {
+		DBDriver = defaultDBDriver
+	}
+
+	// File backed databases only require the path to the database file.
+	if DBDriver == "sqlite" {
+		DBPath = os.Getenv("DB_PATH")
+		if DBPath == "" {
+			return ErrNoDBPath
+		}
+		return nil
+	}
 
 	DBHost = os.Getenv("DB_HOST")
 	if DBHost == "" {
@@ -79,6 +270,9 @@ func InitEnv() error {
 	DBPort = os.Getenv("DB_PORT")
 	if DBPort == "" {
 		DBPort = defaultDBPort
+		if DBDriver == "postgres" {
+			DBPort = defaultPostgresDBPort
+		}
 	}
 
 	DBName = os.Getenv("DB_NAME")
@@ -89,6 +283,9 @@ func InitEnv() error {
 	DBUser = os.Getenv("DB_USER")
 	if DBUser == "" {
 		DBUser = defaultDBUser
+		if DBDriver == "postgres" {
+			DBUser = defaultPostgresDBUser
+		}
 	}
 
 	DBPassword = os.Getenv("DB_PASSWORD")
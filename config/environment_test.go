@@ -2,6 +2,7 @@ package config_test
 
 import (
 	"os"
+	"time"
 
 	. "github.com/nicday/turtle/config"
 
@@ -44,6 +45,257 @@ var _ = Describe("config", func() {
 				Expect(err).To(Equal(ErrNoDBName))
 			})
 		})
+
+		Context("with LOCK_TIMEOUT", func() {
+			AfterEach(func() {
+				os.Setenv("LOCK_TIMEOUT", "")
+			})
+
+			It("sets the lock timeout", func() {
+				os.Setenv("LOCK_TIMEOUT", "30s")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(LockTimeout).To(Equal(30 * time.Second))
+			})
+
+			It("returns an error when it isn't a duration", func() {
+				os.Setenv("LOCK_TIMEOUT", "30")
+
+				err := InitEnv()
+				Expect(err).To(Equal(ErrInvalidLockTimeout))
+			})
+		})
+
+		Context("without TEMPLATES_PATH", func() {
+			AfterEach(func() {
+				os.Setenv("MIGRATIONS_PATH", "")
+			})
+
+			It("uses the templates directory in the migrations path", func() {
+				os.Setenv("MIGRATIONS_PATH", "db/migrations")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(TemplatesPath).To(Equal("db/migrations/templates"))
+			})
+		})
+
+		Context("with SCHEMA_DUMP", func() {
+			AfterEach(func() {
+				os.Setenv("SCHEMA_DUMP", "")
+			})
+
+			It("turns off the schema dump", func() {
+				os.Setenv("SCHEMA_DUMP", "false")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(SchemaDump).To(BeFalse())
+			})
+
+			It("returns an error when it isn't a boolean", func() {
+				os.Setenv("SCHEMA_DUMP", "never")
+
+				err := InitEnv()
+				Expect(err).To(Equal(ErrInvalidSchemaDump))
+			})
+		})
+
+		Context("with ID_SCHEME and ID_PADDING", func() {
+			AfterEach(func() {
+				os.Setenv("ID_SCHEME", "")
+				os.Setenv("ID_PADDING", "")
+			})
+
+			It("defaults to timestamps", func() {
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(IDScheme).To(Equal(IDSchemeTimestamp))
+				Expect(IDPadding).To(Equal(4))
+			})
+
+			It("sets the ID scheme and padding", func() {
+				os.Setenv("ID_SCHEME", "sequential")
+				os.Setenv("ID_PADDING", "6")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(IDScheme).To(Equal(IDSchemeSequential))
+				Expect(IDPadding).To(Equal(6))
+			})
+
+			It("returns an error when ID_SCHEME isn't a scheme", func() {
+				os.Setenv("ID_SCHEME", "uuid")
+
+				err := InitEnv()
+				Expect(err).To(Equal(ErrInvalidIDScheme))
+			})
+
+			It("returns an error when ID_PADDING isn't a positive integer", func() {
+				os.Setenv("ID_PADDING", "0")
+
+				err := InitEnv()
+				Expect(err).To(Equal(ErrInvalidIDPadding))
+			})
+		})
+
+		Context("with TRANSACTION_MODE", func() {
+			AfterEach(func() {
+				os.Setenv("TRANSACTION_MODE", "")
+			})
+
+			It("sets the transaction mode", func() {
+				os.Setenv("TRANSACTION_MODE", "all")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(TransactionMode).To(Equal(TransactionAll))
+			})
+
+			It("returns an error when it isn't a mode", func() {
+				os.Setenv("TRANSACTION_MODE", "none")
+
+				err := InitEnv()
+				Expect(err).To(Equal(ErrInvalidTransactionMode))
+			})
+		})
+
+		Context("with OUT_OF_ORDER", func() {
+			AfterEach(func() {
+				os.Setenv("OUT_OF_ORDER", "")
+			})
+
+			It("sets the out of order policy", func() {
+				os.Setenv("OUT_OF_ORDER", "warn")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(OutOfOrder).To(Equal(OutOfOrderWarn))
+			})
+
+			It("returns an error when it isn't a policy", func() {
+				os.Setenv("OUT_OF_ORDER", "ignore")
+
+				err := InitEnv()
+				Expect(err).To(Equal(ErrInvalidOutOfOrder))
+			})
+		})
+
+		Context("with MIGRATION_SETS", func() {
+			AfterEach(func() {
+				os.Setenv("MIGRATION_SETS", "")
+				os.Setenv("SET_ORDER", "")
+				InitEnv()
+			})
+
+			It("parses the sets, defaulting their tables to the migrations table name and the set name", func() {
+				os.Setenv("MIGRATION_SETS", "core:db/core, billing:db/billing:billing_log")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(MigrationSets).To(Equal([]MigrationSet{
+					{Name: "core", Path: "db/core", Table: "migrations_core"},
+					{Name: "billing", Path: "db/billing", Table: "billing_log"},
+				}))
+				Expect(SetOrder).To(Equal(SetOrderSet))
+			})
+
+			It("returns an error when a set has no path", func() {
+				os.Setenv("MIGRATION_SETS", "core")
+
+				err := InitEnv()
+				Expect(err).To(Equal(ErrInvalidMigrationSets))
+			})
+
+			It("returns an error when a set is listed twice", func() {
+				os.Setenv("MIGRATION_SETS", "core:db/core,core:db/other")
+
+				err := InitEnv()
+				Expect(err).To(MatchError(ContainSubstring("core is listed twice")))
+			})
+
+			It("sets the set order", func() {
+				os.Setenv("SET_ORDER", "combined")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(SetOrder).To(Equal(SetOrderCombined))
+			})
+
+			It("returns an error when SET_ORDER isn't an order", func() {
+				os.Setenv("SET_ORDER", "random")
+
+				err := InitEnv()
+				Expect(err).To(Equal(ErrInvalidSetOrder))
+			})
+		})
+
+		Describe(".UseMigrationSet", func() {
+			AfterEach(func() {
+				os.Setenv("MIGRATION_SETS", "")
+				InitEnv()
+			})
+
+			It("uses the path and table of the set", func() {
+				os.Setenv("MIGRATION_SETS", "core:db/core,billing:db/billing")
+				Expect(InitEnv()).To(Succeed())
+
+				err := UseMigrationSet("billing")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(MigrationsPath).To(Equal("db/billing"))
+				Expect(MigrationsTableName).To(Equal("migrations_billing"))
+				Expect(CurrentMigrationSet).To(Equal("billing"))
+			})
+
+			It("returns an error for a set that isn't configured", func() {
+				err := UseMigrationSet("reporting")
+				Expect(err).To(MatchError(ContainSubstring(ErrUnknownMigrationSet.Error())))
+			})
+		})
+
+		Context("without DB_DRIVER", func() {
+			It("defaults to mysql", func() {
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(DBDriver).To(Equal("mysql"))
+			})
+		})
+
+		Context("with DB_DRIVER=sqlite", func() {
+			It("only requires DB_PATH", func() {
+				os.Setenv("DB_DRIVER", "sqlite")
+				os.Setenv("DB_HOST", "")
+				os.Setenv("DB_NAME", "")
+				os.Setenv("DB_PATH", "turtle.db")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(DBPath).To(Equal("turtle.db"))
+			})
+
+			It("returns an error without DB_PATH", func() {
+				os.Setenv("DB_DRIVER", "sqlite")
+				os.Setenv("DB_PATH", "")
+
+				err := InitEnv()
+				Expect(err).To(HaveOccurred())
+				Expect(err).To(Equal(ErrNoDBPath))
+			})
+		})
+
+		Context("with DB_DRIVER=postgres", func() {
+			It("defaults the port and user for postgres", func() {
+				os.Setenv("DB_DRIVER", "postgres")
+				os.Setenv("DB_PORT", "")
+				os.Setenv("DB_USER", "")
+
+				err := InitEnv()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(DBPort).To(Equal("5432"))
+				Expect(DBUser).To(Equal("postgres"))
+			})
+		})
 	})
 
 	Describe(".IsTestEnv", func() {
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// SetOrderSet runs the migrations of each migration set in turn.
+	SetOrderSet = "set"
+
+	// SetOrderCombined runs the migrations of all the migration sets in a single order by ID, as if they were in one
+	// directory.
+	SetOrderCombined = "combined"
+)
+
+var (
+	// MigrationSets are the named migration directories sharing the database, from MIGRATION_SETS. It is empty when
+	// only MigrationsPath is used.
+	MigrationSets []MigrationSet
+
+	// CurrentMigrationSet is the name of the migration set selected with UseMigrationSet, or empty when no set is
+	// selected.
+	CurrentMigrationSet string
+
+	// SetOrder is how commands run the migrations of all the sets when no set is selected, either SetOrderSet or
+	// SetOrderCombined.
+	SetOrder = SetOrderSet
+
+	// ErrInvalidMigrationSets is raised when MIGRATION_SETS isn't a list of `name:path` or `name:path:table`
+	ErrInvalidMigrationSets = errors.New("MIGRATION_SETS must be a comma separated list of `name:path` or `name:path:table`")
+
+	// ErrInvalidSetOrder is raised when SET_ORDER isn't `set` or `combined`
+	ErrInvalidSetOrder = errors.New("SET_ORDER must be `set` or `combined`")
+
+	// ErrUnknownMigrationSet is raised when selecting a migration set that isn't in MIGRATION_SETS
+	ErrUnknownMigrationSet = errors.New("migration set not found in MIGRATION_SETS")
+)
+
+// MigrationSet is a named directory of migrations, recorded in its own migrations table.
+type MigrationSet struct {
+	Name  string
+	Path  string
+	Table string
+}
+
+// ParseMigrationSets parses a comma separated list of `name:path` or `name:path:table` sets. Sets without a table are
+// recorded in a `<table>_<name>` table.
+func ParseMigrationSets(s string, table string) ([]MigrationSet, error) {
+	sets := []MigrationSet{}
+	names := map[string]bool{}
+
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, ErrInvalidMigrationSets
+		}
+		if names[parts[0]] {
+			return nil, fmt.Errorf("%v: %s is listed twice", ErrInvalidMigrationSets, parts[0])
+		}
+		names[parts[0]] = true
+
+		set := MigrationSet{Name: parts[0], Path: parts[1], Table: table + "_" + parts[0]}
+		if len(parts) == 3 && parts[2] != "" {
+			set.Table = parts[2]
+		}
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
+
+// UseMigrationSet selects the named migration set, so that MigrationsPath and MigrationsTableName are those of the set.
+func UseMigrationSet(name string) error {
+	for _, set := range MigrationSets {
+		if set.Name == name {
+			MigrationsPath = set.Path
+			MigrationsTableName = set.Table
+			CurrentMigrationSet = set.Name
+			return nil
+		}
+	}
+	return fmt.Errorf("%v: %s", ErrUnknownMigrationSet, name)
+}
@@ -0,0 +1,4 @@
+package config
+
+// Version is the version of turtle. It is recorded in the migrations table with each applied migration.
+const Version = "0.0.1"
@@ -9,6 +9,8 @@ import (
 
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
+	// postgres driver
+	_ "github.com/lib/pq"
 	"github.com/nicday/turtle/config"
 
 	"github.com/cenkalti/backoff"
@@ -25,8 +27,19 @@ var (
 	ErrUnableToConnectToDB = errors.New("unable to connect to the database")
 )
 
-// InitConnection initializes the database connection
+// InitConnection initializes the database connection used for migrations.
 func InitConnection() {
+	initConnection(ConnString)
+}
+
+// InitMaintenanceConnection initializes a database connection that isn't bound to the migrations database, so that it
+// can be created or dropped.
+func InitMaintenanceConnection() {
+	initConnection(MaintenanceConnString)
+}
+
+// initConnection loads the environment and opens a connection with the connection string returned by connString.
+func initConnection(connString func() string) {
 	err := config.InitEnv()
 	if err != nil {
 		log.Fatal(err)
@@ -35,9 +48,8 @@ func InitConnection() {
 	if config.IsTestEnv() {
 		return
 	}
-	connString := ConnString()
 
-	c, err := sql.Open("mysql", connString)
+	c, err := sql.Open(CurrentDialect().DriverName(), connString())
 	if err != nil {
 		log.Println("[Error]", err)
 		log.Fatal(ErrUnableToParseDBConnection)
@@ -54,15 +66,13 @@ func InitConnection() {
 
 // ConnString returns the connection string for the database driver.
 func ConnString() string {
-	switch config.DBDriver {
-	case "mysql":
-		return mysqlConnString()
-	case "postgres":
-		return postgresConnString()
-	default:
-		log.Fatal(config.ErrUnknownDBDriver)
-		return ""
-	}
+	return CurrentDialect().ConnString()
+}
+
+// MaintenanceConnString returns the connection string for the database driver that doesn't require the migrations
+// database to exist.
+func MaintenanceConnString() string {
+	return CurrentDialect().MaintenanceConnString()
 }
 
 func connCredentials() string {
@@ -72,14 +82,6 @@ func connCredentials() string {
 	return config.DBUser
 }
 
-func mysqlConnString() string {
-	return fmt.Sprintf("%s@tcp(%s:%s)/", connCredentials(), config.DBHost, config.DBPort)
-}
-
-func postgresConnString() string {
-	return fmt.Sprintf("postgres://%s@%s:%s/%s?sslmode=disable", connCredentials(), config.DBHost, config.DBPort, config.DBName)
-}
-
 // VerifyConnection pings the database to verify a connection is established. If the connection cannot be established,
 // it will retry with an exponential back off.
 func VerifyConnection(c *sql.DB) error {
@@ -99,9 +101,14 @@ func VerifyConnection(c *sql.DB) error {
 }
 
 // UseDB runs the `USE` SQL command, ensuring that all future SQL commands on the database connection use the named
-// database.
+// database. Drivers that bind the connection to the database, such as postgres, don't require this.
 func UseDB() error {
-	_, err := Conn.Exec(fmt.Sprintf("USE %s", config.DBName))
+	query := CurrentDialect().UseDBSQL(config.DBName)
+	if query == "" {
+		return nil
+	}
+
+	_, err := Conn.Exec(query)
 
 	if err != nil {
 		return err
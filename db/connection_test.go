@@ -27,12 +27,12 @@ var _ = Describe("db", func() {
 
 	Describe(".ConnString", func() {
 		Context("when DB_DRIVER=mysql", func() {
-			It("returns a mysql connection string", func() {
+			It("returns a mysql connection string bound to the database", func() {
 				os.Setenv("DB_DRIVER", "mysql")
 				config.InitEnv()
 
 				actual := ConnString()
-				expected := "user@tcp(host:port)/"
+				expected := "user@tcp(host:port)/test"
 				Expect(actual).To(Equal(expected))
 			})
 		})
@@ -48,6 +48,42 @@ var _ = Describe("db", func() {
 			})
 		})
 	})
+
+	Describe(".MaintenanceConnString", func() {
+		Context("when DB_DRIVER=mysql", func() {
+			It("returns a mysql connection string without a database", func() {
+				os.Setenv("DB_DRIVER", "mysql")
+				config.InitEnv()
+
+				actual := MaintenanceConnString()
+				expected := "user@tcp(host:port)/"
+				Expect(actual).To(Equal(expected))
+			})
+		})
+
+		Context("when DB_DRIVER=postgres", func() {
+			It("returns a postgres connection string for the maintenance database", func() {
+				os.Setenv("DB_DRIVER", "postgres")
+				config.InitEnv()
+
+				actual := MaintenanceConnString()
+				expected := "postgres://user@host:port/postgres?sslmode=disable"
+				Expect(actual).To(Equal(expected))
+			})
+		})
+	})
+
+	Describe(".UseDB", func() {
+		Context("when DB_DRIVER=postgres", func() {
+			It("doesn't query the database", func() {
+				os.Setenv("DB_DRIVER", "postgres")
+				config.InitEnv()
+
+				err := UseDB()
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	})
 })
 
 func OverwriteEnv(envVar, val string) {
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"github.com/nicday/turtle/config"
+)
+
+// CreateDB creates the configured database on the host. The connection must not be bound to the database, see
+// InitMaintenanceConnection.
+func CreateDB() error {
+	if m, ok := CurrentDialect().(DatabaseManager); ok {
+		return m.CreateDatabase()
+	}
+
+	_, err := Conn.Exec(CurrentDialect().CreateDatabaseSQL(config.DBName))
+	return err
+}
+
+// DropDB drops the configured database from the host. The connection must not be bound to the database, see
+// InitMaintenanceConnection.
+func DropDB() error {
+	if m, ok := CurrentDialect().(DatabaseManager); ok {
+		return m.DropDatabase()
+	}
+
+	_, err := Conn.Exec(CurrentDialect().DropDatabaseSQL(config.DBName))
+	return err
+}
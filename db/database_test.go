@@ -0,0 +1,62 @@
+package db_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/nicday/turtle/config"
+	. "github.com/nicday/turtle/db"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("database", func() {
+	Context("with DB_DRIVER=sqlite", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "turtle")
+			Expect(err).NotTo(HaveOccurred())
+
+			config.DBDriver = "sqlite"
+			config.DBPath = path.Join(dir, "turtle.db")
+		})
+
+		AfterEach(func() {
+			config.DBDriver = "mysql"
+			os.RemoveAll(dir)
+		})
+
+		Describe(".CreateDB", func() {
+			It("creates the database file", func() {
+				err := CreateDB()
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = os.Stat(config.DBPath)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns an error when the database file exists", func() {
+				Expect(CreateDB()).To(Succeed())
+
+				err := CreateDB()
+				Expect(err).To(Equal(ErrDBFileExists))
+			})
+		})
+
+		Describe(".DropDB", func() {
+			It("removes the database file", func() {
+				Expect(CreateDB()).To(Succeed())
+
+				err := DropDB()
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = os.Stat(config.DBPath)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+})
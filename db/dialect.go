@@ -0,0 +1,172 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/nicday/turtle/config"
+)
+
+// Dialect describes the differences in SQL and connection handling between database drivers. Implementations are
+// registered with RegisterDialect under the name used for DB_DRIVER.
+type Dialect interface {
+	// DriverName returns the name the database/sql driver is registered under.
+	DriverName() string
+
+	// ConnString returns the connection string used for migrations.
+	ConnString() string
+
+	// MaintenanceConnString returns the connection string used to create and drop the database.
+	MaintenanceConnString() string
+
+	// Placeholder returns the bind parameter for the nth (1-indexed) argument of a query.
+	Placeholder(n int) string
+
+	// QuoteIdentifier quotes a table or database name for use in SQL.
+	QuoteIdentifier(name string) string
+
+	// UseDBSQL returns the SQL for selecting the database, or an empty string if the connection is already bound to it.
+	UseDBSQL(name string) string
+
+	// TableExistsSQL returns a query, and its arguments, that selects the number of tables named table in the schema,
+	// or in the current database when schema is empty.
+	TableExistsSQL(schema, table string) (string, []interface{})
+
+	// TransactionalDDL returns true if DDL statements, such as CREATE TABLE, can be rolled back as part of a
+	// transaction. When it's false, DDL statements implicitly commit the transaction they run in.
+	TransactionalDDL() bool
+
+	// Syntax returns the lexical rules of the dialect's SQL, used to split migrations into statements.
+	Syntax() Syntax
+
+	// CreateMigrationsTableSQL returns the SQL for creating the migrations table, with an auto-incrementing id, a unique
+	// migration_id and the columns from MigrationsTableColumnsSQL.
+	CreateMigrationsTableSQL(table string) string
+
+	// CreateDatabaseSQL returns the SQL for creating the database.
+	CreateDatabaseSQL(name string) string
+
+	// DropDatabaseSQL returns the SQL for dropping the database.
+	DropDatabaseSQL(name string) string
+
+	// TryLockSQL returns a query that attempts to acquire the named lock without waiting, selecting true if it was
+	// acquired. The lock must be held by the session until it's released with UnlockSQL. An empty string is returned if
+	// the database doesn't support named locks, a lock table is used instead.
+	TryLockSQL(name string) string
+
+	// UnlockSQL returns a query that releases the named lock held by the session.
+	UnlockSQL(name string) string
+
+	// LockHolderSQL returns a query that selects the ID of the session holding the named lock, if any.
+	LockHolderSQL(name string) string
+
+	// KillSessionSQL returns the SQL for ending a session, releasing any locks it holds.
+	KillSessionSQL(id int64) string
+}
+
+// Syntax describes the lexical rules of a dialect's SQL that matter when splitting a script into statements. Single
+// quoted strings, double quoted and backticked identifiers, `--` and `/* */` comments, and MySQL client `DELIMITER`
+// lines are understood for every dialect.
+type Syntax struct {
+	// BackslashEscapes is true if a backslash escapes the next character in quoted strings.
+	BackslashEscapes bool
+
+	// HashComments is true if `#` starts a comment that runs to the end of the line.
+	HashComments bool
+
+	// DollarQuoting is true if strings can be quoted with `$$` or `$tag$`, e.g. for function bodies.
+	DollarQuoting bool
+
+	// EscapeStrings is true if a string prefixed with E, e.g. `E'It\'s'`, is one in which a backslash escapes the next
+	// character, as in PostgreSQL.
+	EscapeStrings bool
+
+	// TriggerBlocks is true if the body of a CREATE TRIGGER statement is a `BEGIN ... END` block of statements, which
+	// doesn't need a DELIMITER line, as in SQLite.
+	TriggerBlocks bool
+}
+
+// DatabaseManager is implemented by dialects that create and drop the database without SQL, such as file backed
+// databases. CreateDB and DropDB will use it in place of CreateDatabaseSQL and DropDatabaseSQL.
+type DatabaseManager interface {
+	CreateDatabase() error
+	DropDatabase() error
+}
+
+var dialects = map[string]Dialect{}
+
+// RegisterDialect makes a dialect available for the DB_DRIVER name. It panics if a dialect is registered twice for the
+// same name.
+func RegisterDialect(name string, d Dialect) {
+	if _, ok := dialects[name]; ok {
+		panic(fmt.Sprintf("db: dialect %s registered twice", name))
+	}
+	dialects[name] = d
+}
+
+// Dialects returns the sorted names of the registered dialects.
+func Dialects() []string {
+	names := []string{}
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupDialect returns the dialect registered for the name, or config.ErrUnknownDBDriver if there isn't one.
+func LookupDialect(name string) (Dialect, error) {
+	d, ok := dialects[name]
+	if !ok {
+		return nil, config.ErrUnknownDBDriver
+	}
+	return d, nil
+}
+
+// CurrentDialect returns the dialect for the configured database driver.
+func CurrentDialect() Dialect {
+	d, err := LookupDialect(config.DBDriver)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return d
+}
+
+// quoteIdentifier quotes each dot separated part of name with the quote character, escaping any quote characters
+// within the name.
+func quoteIdentifier(name string, quote string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quote + strings.Replace(part, quote, quote+quote, -1) + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteString quotes a string literal for use in SQL.
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// nullableString quotes a string for use in SQL, or returns NULL if it's empty.
+func nullableString(s string) string {
+	if s == "" {
+		return "NULL"
+	}
+	return quoteString(s)
+}
+
+// unqualified returns the table name without any schema or database qualifier.
+func unqualified(table string) string {
+	return table[strings.LastIndex(table, ".")+1:]
+}
+
+// qualifier returns the schema or database qualifier of the table name, or an empty string if it isn't qualified.
+func qualifier(table string) string {
+	i := strings.LastIndex(table, ".")
+	if i < 0 {
+		return ""
+	}
+	return table[:i]
+}
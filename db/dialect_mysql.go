@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/nicday/turtle/config"
+)
+
+func init() {
+	RegisterDialect("mysql", mysqlDialect{})
+}
+
+// mysqlDialect implements Dialect for MySQL.
+type mysqlDialect struct{}
+
+func (mysqlDialect) DriverName() string { return "mysql" }
+
+// ConnString returns a connection string bound to the configured database. Every connection in the pool must use the
+// database, as the migration lock holds one connection for the whole run and the others are opened after `USE`.
+func (mysqlDialect) ConnString() string { return mysqlConnString(config.DBName) }
+
+// MaintenanceConnString returns a connection string that isn't bound to a database, so that it can be created or
+// dropped.
+func (mysqlDialect) MaintenanceConnString() string { return mysqlConnString("") }
+
+func (mysqlDialect) Placeholder(n int) string { return "?" }
+
+func (mysqlDialect) QuoteIdentifier(name string) string { return quoteIdentifier(name, "`") }
+
+func (d mysqlDialect) UseDBSQL(name string) string {
+	return fmt.Sprintf("USE %s", d.QuoteIdentifier(name))
+}
+
+func (mysqlDialect) TableExistsSQL(schema, table string) (string, []interface{}) {
+	if schema != "" {
+		return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = ? AND table_name = ?",
+			[]interface{}{schema, table}
+	}
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?",
+		[]interface{}{table}
+}
+
+// TransactionalDDL returns false, MySQL implicitly commits the transaction before and after a DDL statement.
+func (mysqlDialect) TransactionalDDL() bool { return false }
+
+func (mysqlDialect) Syntax() Syntax { return Syntax{BackslashEscapes: true, HashComments: true} }
+
+func (d mysqlDialect) CreateMigrationsTableSQL(table string) string {
+	return fmt.Sprintf(
+		"CREATE TABLE %s (id INT NOT NULL AUTO_INCREMENT, migration_id VARCHAR(255) NOT NULL UNIQUE, %s, PRIMARY KEY(id))",
+		d.QuoteIdentifier(table),
+		MigrationsTableColumnsSQL(),
+	)
+}
+
+func (d mysqlDialect) CreateDatabaseSQL(name string) string {
+	return fmt.Sprintf("CREATE DATABASE %s", d.QuoteIdentifier(name))
+}
+
+func (d mysqlDialect) DropDatabaseSQL(name string) string {
+	return fmt.Sprintf("DROP DATABASE %s", d.QuoteIdentifier(name))
+}
+
+// TryLockSQL returns a query for a named lock. Lock names are global to the server, so the name is prefixed with the
+// database.
+func (mysqlDialect) TryLockSQL(name string) string {
+	return fmt.Sprintf("SELECT GET_LOCK(%s, 0)", mysqlLockName(name))
+}
+
+func (mysqlDialect) UnlockSQL(name string) string {
+	return fmt.Sprintf("SELECT RELEASE_LOCK(%s)", mysqlLockName(name))
+}
+
+func (mysqlDialect) LockHolderSQL(name string) string {
+	return fmt.Sprintf("SELECT IS_USED_LOCK(%s)", mysqlLockName(name))
+}
+
+func (mysqlDialect) KillSessionSQL(id int64) string {
+	return fmt.Sprintf("KILL %d", id)
+}
+
+// mysqlConnString returns the connection string for the named database, or no database if it's empty.
+func mysqlConnString(name string) string {
+	return fmt.Sprintf("%s@tcp(%s:%s)/%s", connCredentials(), config.DBHost, config.DBPort, name)
+}
+
+func mysqlLockName(name string) string {
+	return fmt.Sprintf("CONCAT(DATABASE(), '.', %s)", quoteString(name))
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/nicday/turtle/config"
+)
+
+// postgresMaintenanceDB is the database that is always present on a PostgreSQL server, it is used when creating and
+// dropping the migrations database.
+const postgresMaintenanceDB = "postgres"
+
+func init() {
+	RegisterDialect("postgres", postgresDialect{})
+}
+
+// postgresDialect implements Dialect for PostgreSQL.
+type postgresDialect struct{}
+
+func (postgresDialect) DriverName() string { return "postgres" }
+
+func (postgresDialect) ConnString() string { return postgresConnString(config.DBName) }
+
+func (postgresDialect) MaintenanceConnString() string {
+	return postgresConnString(postgresMaintenanceDB)
+}
+
+func (postgresDialect) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (postgresDialect) QuoteIdentifier(name string) string { return quoteIdentifier(name, `"`) }
+
+// UseDBSQL returns an empty string, PostgreSQL connections are bound to the database in the connection string.
+func (postgresDialect) UseDBSQL(name string) string { return "" }
+
+func (postgresDialect) TableExistsSQL(schema, table string) (string, []interface{}) {
+	if schema != "" {
+		return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = $1 AND table_name = $2",
+			[]interface{}{schema, table}
+	}
+	return "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1",
+		[]interface{}{table}
+}
+
+func (postgresDialect) TransactionalDDL() bool { return true }
+
+func (postgresDialect) Syntax() Syntax { return Syntax{DollarQuoting: true, EscapeStrings: true} }
+
+func (d postgresDialect) CreateMigrationsTableSQL(table string) string {
+	return fmt.Sprintf(
+		"CREATE TABLE %s (id SERIAL PRIMARY KEY, migration_id VARCHAR(255) NOT NULL UNIQUE, %s)",
+		d.QuoteIdentifier(table),
+		MigrationsTableColumnsSQL(),
+	)
+}
+
+func (d postgresDialect) CreateDatabaseSQL(name string) string {
+	return fmt.Sprintf("CREATE DATABASE %s", d.QuoteIdentifier(name))
+}
+
+func (d postgresDialect) DropDatabaseSQL(name string) string {
+	return fmt.Sprintf("DROP DATABASE %s", d.QuoteIdentifier(name))
+}
+
+// TryLockSQL returns a query for a session level advisory lock, keyed by a hash of the lock name.
+func (postgresDialect) TryLockSQL(name string) string {
+	return fmt.Sprintf("SELECT pg_try_advisory_lock(hashtext(%s))", quoteString(name))
+}
+
+func (postgresDialect) UnlockSQL(name string) string {
+	return fmt.Sprintf("SELECT pg_advisory_unlock(hashtext(%s))", quoteString(name))
+}
+
+// LockHolderSQL returns a query on pg_locks, where the bigint advisory lock key is split over classid and objid.
+func (postgresDialect) LockHolderSQL(name string) string {
+	return fmt.Sprintf(
+		"SELECT pid FROM pg_locks WHERE locktype = 'advisory' AND granted AND objsubid = 1 "+
+			"AND database = (SELECT oid FROM pg_database WHERE datname = current_database()) "+
+			"AND ((classid::bigint << 32) | objid::bigint) = hashtext(%s)::bigint",
+		quoteString(name),
+	)
+}
+
+func (postgresDialect) KillSessionSQL(id int64) string {
+	return fmt.Sprintf("SELECT pg_terminate_backend(%d)", id)
+}
+
+func postgresConnString(name string) string {
+	return fmt.Sprintf("postgres://%s@%s:%s/%s?sslmode=disable", connCredentials(), config.DBHost, config.DBPort, name)
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nicday/turtle/config"
+)
+
+// ErrDBFileExists is raised when creating a sqlite database over an existing file.
+var ErrDBFileExists = errors.New("database file already exists")
+
+func init() {
+	RegisterDialect("sqlite", sqliteDialect{})
+}
+
+// sqliteDialect implements Dialect for SQLite. The database is a file on disk at config.DBPath. The driver needs cgo, so
+// it isn't imported by the library; programs using the dialect import github.com/mattn/go-sqlite3, as cmd/turtle does.
+type sqliteDialect struct{}
+
+func (sqliteDialect) DriverName() string { return "sqlite3" }
+
+func (sqliteDialect) ConnString() string { return config.DBPath }
+
+// MaintenanceConnString returns an in-memory database, the database file is created and dropped without a connection.
+func (sqliteDialect) MaintenanceConnString() string { return ":memory:" }
+
+func (sqliteDialect) Placeholder(n int) string { return "?" }
+
+func (sqliteDialect) QuoteIdentifier(name string) string { return quoteIdentifier(name, `"`) }
+
+// UseDBSQL returns an empty string, SQLite connections are bound to the database file in the connection string.
+func (sqliteDialect) UseDBSQL(name string) string { return "" }
+
+// TableExistsSQL looks the table up in the sqlite_master of the attached database named by schema, if any.
+func (d sqliteDialect) TableExistsSQL(schema, table string) (string, []interface{}) {
+	master := "sqlite_master"
+	if schema != "" {
+		master = d.QuoteIdentifier(schema) + ".sqlite_master"
+	}
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE type = 'table' AND name = ?", master), []interface{}{table}
+}
+
+func (sqliteDialect) TransactionalDDL() bool { return true }
+
+func (sqliteDialect) Syntax() Syntax { return Syntax{TriggerBlocks: true} }
+
+func (d sqliteDialect) CreateMigrationsTableSQL(table string) string {
+	return fmt.Sprintf(
+		"CREATE TABLE %s (id INTEGER PRIMARY KEY AUTOINCREMENT, migration_id VARCHAR(255) NOT NULL UNIQUE, %s)",
+		d.QuoteIdentifier(table),
+		MigrationsTableColumnsSQL(),
+	)
+}
+
+// CreateDatabaseSQL returns an empty string, see CreateDatabase.
+func (sqliteDialect) CreateDatabaseSQL(name string) string { return "" }
+
+// DropDatabaseSQL returns an empty string, see DropDatabase.
+func (sqliteDialect) DropDatabaseSQL(name string) string { return "" }
+
+// TryLockSQL returns an empty string, SQLite doesn't support named locks.
+func (sqliteDialect) TryLockSQL(name string) string { return "" }
+
+func (sqliteDialect) UnlockSQL(name string) string { return "" }
+
+func (sqliteDialect) LockHolderSQL(name string) string { return "" }
+
+func (sqliteDialect) KillSessionSQL(id int64) string { return "" }
+
+// CreateDatabase creates an empty database file at config.DBPath.
+func (sqliteDialect) CreateDatabase() error {
+	f, err := os.OpenFile(config.DBPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return ErrDBFileExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// DropDatabase removes the database file at config.DBPath.
+func (sqliteDialect) DropDatabase() error {
+	return os.Remove(config.DBPath)
+}
@@ -0,0 +1,76 @@
+package db_test
+
+import (
+	"github.com/nicday/turtle/config"
+	. "github.com/nicday/turtle/db"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("dialect", func() {
+	Describe(".Dialects", func() {
+		It("returns the registered dialects", func() {
+			Expect(Dialects()).To(ContainElement("mysql"))
+			Expect(Dialects()).To(ContainElement("postgres"))
+		})
+	})
+
+	Describe(".LookupDialect", func() {
+		Context("with a registered driver", func() {
+			It("returns the dialect", func() {
+				d, err := LookupDialect("postgres")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(d.DriverName()).To(Equal("postgres"))
+			})
+		})
+
+		Context("with an unknown driver", func() {
+			It("returns an error", func() {
+				_, err := LookupDialect("oracle")
+				Expect(err).To(Equal(config.ErrUnknownDBDriver))
+			})
+		})
+	})
+
+	Describe(".RegisterDialect", func() {
+		It("panics when a dialect is registered twice", func() {
+			d, _ := LookupDialect("mysql")
+			Expect(func() { RegisterDialect("mysql", d) }).To(Panic())
+		})
+	})
+
+	Describe("#QuoteIdentifier", func() {
+		Context("with mysql", func() {
+			It("quotes each part of the name with backticks", func() {
+				d, _ := LookupDialect("mysql")
+				Expect(d.QuoteIdentifier("test.migrations")).To(Equal("`test`.`migrations`"))
+				Expect(d.QuoteIdentifier("odd`name")).To(Equal("`odd``name`"))
+			})
+		})
+
+		Context("with postgres", func() {
+			It("quotes each part of the name with double quotes", func() {
+				d, _ := LookupDialect("postgres")
+				Expect(d.QuoteIdentifier("public.migrations")).To(Equal(`"public"."migrations"`))
+			})
+		})
+	})
+
+	Describe("#TryLockSQL", func() {
+		It("returns the driver specific lock statements", func() {
+			mysql, _ := LookupDialect("mysql")
+			Expect(mysql.TryLockSQL("turtle")).To(Equal("SELECT GET_LOCK(CONCAT(DATABASE(), '.', 'turtle'), 0)"))
+			Expect(mysql.UnlockSQL("turtle")).To(Equal("SELECT RELEASE_LOCK(CONCAT(DATABASE(), '.', 'turtle'))"))
+
+			postgres, _ := LookupDialect("postgres")
+			Expect(postgres.TryLockSQL("turtle")).To(Equal("SELECT pg_try_advisory_lock(hashtext('turtle'))"))
+			Expect(postgres.UnlockSQL("turtle")).To(Equal("SELECT pg_advisory_unlock(hashtext('turtle'))"))
+		})
+
+		It("returns an empty string when the driver doesn't support named locks", func() {
+			sqlite, _ := LookupDialect("sqlite")
+			Expect(sqlite.TryLockSQL("turtle")).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// lockPollInterval is how often an unavailable migration lock is retried.
+const lockPollInterval = 250 * time.Millisecond
+
+// lockID is the row ID of the lock in a lock table.
+const lockID = 1
+
+// ErrLockTimeout is raised when the migration lock can't be acquired before the wait timeout.
+var ErrLockTimeout = errors.New("timed out waiting for the migration lock, another migration may be running")
+
+// Lock is a held migration lock.
+type Lock struct {
+	release func(ctx context.Context) error
+}
+
+// Release releases the migration lock.
+func (l *Lock) Release(ctx context.Context) error {
+	return l.release(ctx)
+}
+
+// Lock acquires the migration lock, waiting up to timeout for another process to release it. The lock uses the
+// dialect's named locks, which are held by a dedicated connection, or a lock table if the dialect doesn't support them.
+func (l *Log) Lock(ctx context.Context, timeout time.Duration) (*Lock, error) {
+	query := l.Dialect.TryLockSQL(l.lockName())
+	if query == "" {
+		return l.lockTable(ctx, timeout)
+	}
+
+	// Named locks belong to the session, so the same connection must be used to acquire and release it.
+	conn, err := l.Conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = poll(ctx, timeout, func() (bool, error) {
+		var acquired bool
+		err := conn.QueryRowContext(ctx, query).Scan(&acquired)
+		return acquired, err
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	lock := &Lock{
+		release: func(ctx context.Context) error {
+			defer conn.Close()
+			_, err := conn.ExecContext(ctx, l.Dialect.UnlockSQL(l.lockName()))
+			return err
+		},
+	}
+
+	return lock, nil
+}
+
+// ForceUnlock clears the migration lock, whichever process holds it. With named locks the session holding the lock is
+// ended.
+func (l *Log) ForceUnlock(ctx context.Context) error {
+	if l.Dialect.TryLockSQL(l.lockName()) == "" {
+		_, err := l.Conn.ExecContext(ctx, l.createLockTableSQL())
+		if err != nil {
+			return err
+		}
+
+		_, err = l.Conn.ExecContext(ctx, l.deleteLockSQL())
+		return err
+	}
+
+	var holder sql.NullInt64
+
+	err := l.Conn.QueryRowContext(ctx, l.Dialect.LockHolderSQL(l.lockName())).Scan(&holder)
+	if err == sql.ErrNoRows || (err == nil && !holder.Valid) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = l.Conn.ExecContext(ctx, l.Dialect.KillSessionSQL(holder.Int64))
+	return err
+}
+
+// lockTable acquires the migration lock by inserting a row into the lock table.
+func (l *Log) lockTable(ctx context.Context, timeout time.Duration) (*Lock, error) {
+	_, err := l.Conn.ExecContext(ctx, l.createLockTableSQL())
+	if err != nil {
+		return nil, err
+	}
+
+	err = poll(ctx, timeout, func() (bool, error) {
+		_, err := l.Conn.ExecContext(ctx, l.insertLockSQL(), lockID)
+		if err == nil {
+			return true, nil
+		}
+
+		// The insert fails when the lock is held, any other error is returned.
+		var count int
+		if countErr := l.Conn.QueryRowContext(ctx, l.countLockSQL()).Scan(&count); countErr != nil || count == 0 {
+			return false, err
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &Lock{
+		release: func(ctx context.Context) error {
+			_, err := l.Conn.ExecContext(ctx, l.deleteLockSQL())
+			return err
+		},
+	}
+
+	return lock, nil
+}
+
+// poll calls try until it succeeds, returning ErrLockTimeout if it hasn't once timeout has elapsed.
+func poll(ctx context.Context, timeout time.Duration, try func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return ErrLockTimeout
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// lockName returns the name of the migration lock.
+func (l *Log) lockName() string {
+	return "turtle." + l.Table
+}
+
+// lockTableName returns the quoted lock table name.
+func (l *Log) lockTableName() string {
+	return l.Dialect.QuoteIdentifier(l.Table + "_lock")
+}
+
+// createLockTableSQL returns the SQL for creating the lock table, if it doesn't exist.
+func (l *Log) createLockTableSQL() string {
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (id INTEGER NOT NULL PRIMARY KEY, locked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)",
+		l.lockTableName(),
+	)
+}
+
+// insertLockSQL returns the SQL for acquiring the lock in the lock table.
+func (l *Log) insertLockSQL() string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (id) VALUES (%s)",
+		l.lockTableName(),
+		l.Dialect.Placeholder(1),
+	)
+}
+
+// countLockSQL returns the SQL for checking if the lock is held in the lock table.
+func (l *Log) countLockSQL() string {
+	return fmt.Sprintf(
+		"SELECT COUNT(*) FROM %s",
+		l.lockTableName(),
+	)
+}
+
+// deleteLockSQL returns the SQL for releasing the lock in the lock table.
+func (l *Log) deleteLockSQL() string {
+	return fmt.Sprintf(
+		"DELETE FROM %s",
+		l.lockTableName(),
+	)
+}
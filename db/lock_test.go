@@ -0,0 +1,202 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+
+	// sqlite driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nicday/turtle/config"
+	. "github.com/nicday/turtle/db"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v0"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lock", func() {
+	ctx := context.Background()
+
+	Context("with a lock table", func() {
+		var (
+			dir  string
+			conn *sql.DB
+			log  *Log
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "turtle")
+			Expect(err).NotTo(HaveOccurred())
+
+			conn, err = sql.Open("sqlite3", path.Join(dir, "turtle.db"))
+			Expect(err).NotTo(HaveOccurred())
+
+			dialect, err := LookupDialect("sqlite")
+			Expect(err).NotTo(HaveOccurred())
+			log = NewLog(conn, dialect, "migrations")
+		})
+
+		AfterEach(func() {
+			conn.Close()
+			os.RemoveAll(dir)
+		})
+
+		It("can only be held once", func() {
+			lock, err := log.Lock(ctx, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = log.Lock(ctx, 0)
+			Expect(err).To(Equal(ErrLockTimeout))
+
+			Expect(lock.Release(ctx)).To(Succeed())
+
+			lock, err = log.Lock(ctx, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock.Release(ctx)).To(Succeed())
+		})
+
+		Describe("#ForceUnlock", func() {
+			It("clears a held lock", func() {
+				_, err := log.Lock(ctx, 0)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(log.ForceUnlock(ctx)).To(Succeed())
+
+				lock, err := log.Lock(ctx, 0)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(lock.Release(ctx)).To(Succeed())
+			})
+		})
+	})
+
+	Context("with named locks", func() {
+		var log *Log
+
+		BeforeEach(func() {
+			dialect, err := LookupDialect("mysql")
+			Expect(err).NotTo(HaveOccurred())
+			log = NewLog(Conn, dialect, "migrations")
+		})
+
+		It("acquires and releases the named lock", func() {
+			sqlmock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(CONCAT(DATABASE(), '.', 'turtle.migrations'), 0)")).
+				WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(1))
+			sqlmock.ExpectExec(regexp.QuoteMeta("SELECT RELEASE_LOCK(CONCAT(DATABASE(), '.', 'turtle.migrations'))")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+
+			lock, err := log.Lock(ctx, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock.Release(ctx)).To(Succeed())
+		})
+
+		It("times out when the lock is held elsewhere", func() {
+			sqlmock.ExpectQuery(regexp.QuoteMeta("SELECT GET_LOCK(CONCAT(DATABASE(), '.', 'turtle.migrations'), 0)")).
+				WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(0))
+
+			_, err := log.Lock(ctx, 0)
+			Expect(err).To(Equal(ErrLockTimeout))
+		})
+
+		It("leaves the other connections bound to the database", func() {
+			previous := config.DBName
+			config.DBName = "test"
+			defer func() { config.DBName = previous }()
+
+			dialect, err := LookupDialect("mysql")
+			Expect(err).NotTo(HaveOccurred())
+
+			recorder.dsns = nil
+			conn, err := sql.Open("turtle-lock-test", dialect.ConnString())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			log := NewLog(conn, dialect, "migrations")
+			lock, err := log.Lock(ctx, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The lock holds the first connection, so the query opens another one.
+			_, err = log.TablePresent(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lock.Release(ctx)).To(Succeed())
+
+			Expect(recorder.dsns).To(HaveLen(2))
+			for _, dsn := range recorder.dsns {
+				Expect(dsn).To(HaveSuffix("/test"))
+			}
+		})
+
+		Describe("#ForceUnlock", func() {
+			It("ends the session holding the lock", func() {
+				sqlmock.ExpectQuery(regexp.QuoteMeta("SELECT IS_USED_LOCK(CONCAT(DATABASE(), '.', 'turtle.migrations'))")).
+					WillReturnRows(sqlmock.NewRows([]string{"holder"}).AddRow(42))
+				sqlmock.ExpectExec(regexp.QuoteMeta("KILL 42")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				Expect(log.ForceUnlock(ctx)).To(Succeed())
+			})
+
+			It("does nothing when the lock isn't held", func() {
+				sqlmock.ExpectQuery(regexp.QuoteMeta("SELECT IS_USED_LOCK(CONCAT(DATABASE(), '.', 'turtle.migrations'))")).
+					WillReturnRows(sqlmock.NewRows([]string{"holder"}).AddRow(nil))
+
+				Expect(log.ForceUnlock(ctx)).To(Succeed())
+			})
+		})
+	})
+})
+
+// recorder is registered as the `turtle-lock-test` driver.
+var recorder = &recordingDriver{}
+
+func init() {
+	sql.Register("turtle-lock-test", recorder)
+}
+
+// recordingDriver records the connection string of each connection it opens. Every query returns a single row with the
+// value 1, and every statement succeeds.
+type recordingDriver struct {
+	dsns []string
+}
+
+func (d *recordingDriver) Open(dsn string) (driver.Conn, error) {
+	d.dsns = append(d.dsns, dsn)
+	return recordingConn{}, nil
+}
+
+type recordingConn struct{}
+
+func (recordingConn) Prepare(query string) (driver.Stmt, error) { return recordingStmt{}, nil }
+func (recordingConn) Close() error                              { return nil }
+func (recordingConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type recordingStmt struct{}
+
+func (recordingStmt) Close() error  { return nil }
+func (recordingStmt) NumInput() int { return -1 }
+func (recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (recordingStmt) Query(args []driver.Value) (driver.Rows, error) { return &recordingRows{}, nil }
+
+type recordingRows struct {
+	done bool
+}
+
+func (*recordingRows) Columns() []string { return []string{"value"} }
+func (*recordingRows) Close() error      { return nil }
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
@@ -0,0 +1,418 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nicday/turtle/config"
+)
+
+// timestampFormat is the format timestamps are returned in by drivers that don't parse them, e.g. MySQL without
+// `parseTime=true`.
+const timestampFormat = "2006-01-02 15:04:05"
+
+// migrationsTableColumns are the columns of the migrations table after id and migration_id, in the order they were
+// added. Tables created by earlier versions of turtle are upgraded by adding the missing columns, so they must all be
+// nullable.
+var migrationsTableColumns = []struct {
+	name       string
+	definition string
+}{
+	{"applied_at", "TIMESTAMP NULL"},
+	{"checksum", "VARCHAR(64) NULL"},
+	{"duration_ms", "BIGINT NULL"},
+	{"turtle_version", "VARCHAR(32) NULL"},
+	{"applied_by", "VARCHAR(255) NULL"},
+}
+
+// MigrationsTableColumnsSQL returns the comma separated definitions of the migrations table columns after id and
+// migration_id, for dialects to use in CreateMigrationsTableSQL.
+func MigrationsTableColumnsSQL() string {
+	definitions := make([]string, len(migrationsTableColumns))
+	for i, c := range migrationsTableColumns {
+		definitions[i] = c.name + " " + c.definition
+	}
+	return strings.Join(definitions, ", ")
+}
+
+// Log records the applied migrations in the migrations table of a database.
+type Log struct {
+	Conn    *sql.DB
+	Dialect Dialect
+	Table   string
+}
+
+// Execer executes a query, it is implemented by *sql.DB and *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Record is a migration in the migrations table.
+type Record struct {
+	ID string
+
+	// AppliedAt is when the migration was applied, in UTC. The fields below are empty for migrations logged before the
+	// migrations table recorded them.
+	AppliedAt time.Time
+
+	// Checksum is the hex encoded SHA-256 checksum of the up migration.
+	Checksum string
+
+	// Duration is how long the up migration took to run, to the millisecond.
+	Duration time.Duration
+
+	// Version is the version of turtle that applied the migration.
+	Version string
+
+	// AppliedBy is the user and host that applied the migration, as user@host.
+	AppliedBy string
+}
+
+// NewLog initializes a new Log for the migrations table on the connection.
+func NewLog(conn *sql.DB, dialect Dialect, table string) *Log {
+	return &Log{
+		Conn:    conn,
+		Dialect: dialect,
+		Table:   table,
+	}
+}
+
+// DefaultLog returns a Log for the package connection, using the configured driver and migrations table.
+func DefaultLog() *Log {
+	return NewLog(Conn, CurrentDialect(), config.MigrationsTableName)
+}
+
+// TablePresent returns true if the migrations table is present in the database, or in its schema when the table name
+// is qualified, e.g. `billing.migrations`.
+func (l *Log) TablePresent(ctx context.Context) (bool, error) {
+	var count int
+
+	query, args := l.Dialect.TableExistsSQL(qualifier(l.Table), unqualified(l.Table))
+	err := l.Conn.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// CreateTable creates the migrations table in the database.
+func (l *Log) CreateTable(ctx context.Context) error {
+	_, err := l.Conn.ExecContext(ctx, l.createTableSQL())
+	return err
+}
+
+// Upgrade adds any columns missing from a migrations table created by an earlier version of turtle.
+func (l *Log) Upgrade(ctx context.Context) error {
+	columns, err := l.columns(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range migrationsTableColumns {
+		if columns[c.name] {
+			continue
+		}
+
+		_, err := l.Conn.ExecContext(ctx, l.addColumnSQL(c.name, c.definition))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DropTable drops the migrations table from the database.
+func (l *Log) DropTable(ctx context.Context) error {
+	_, err := l.Conn.ExecContext(ctx, l.dropTableSQL())
+	return err
+}
+
+// Insert inserts a new migration into the migrations table. AppliedAt defaults to the current time.
+func (l *Log) Insert(ctx context.Context, r Record) error {
+	return l.InsertWith(ctx, l.Conn, r)
+}
+
+// InsertWith inserts a new migration into the migrations table using e, e.g. as part of the migration's transaction.
+// AppliedAt defaults to the current time.
+func (l *Log) InsertWith(ctx context.Context, e Execer, r Record) error {
+	if r.AppliedAt.IsZero() {
+		r.AppliedAt = time.Now().UTC().Truncate(time.Second)
+	}
+
+	_, err := e.ExecContext(
+		ctx,
+		l.insertSQL(),
+		r.ID,
+		r.AppliedAt,
+		r.Checksum,
+		r.Duration.Nanoseconds()/int64(time.Millisecond),
+		r.Version,
+		r.AppliedBy,
+	)
+	return err
+}
+
+// UpdateChecksum updates the recorded checksum of a migration in the migrations table.
+func (l *Log) UpdateChecksum(ctx context.Context, id, checksum string) error {
+	_, err := l.Conn.ExecContext(ctx, l.updateChecksumSQL(), checksum, id)
+	return err
+}
+
+// Delete deletes a migration from the migrations table.
+func (l *Log) Delete(ctx context.Context, id string) error {
+	return l.DeleteWith(ctx, l.Conn, id)
+}
+
+// DeleteWith deletes a migration from the migrations table using e, e.g. as part of the migration's transaction.
+func (l *Log) DeleteWith(ctx context.Context, e Execer, id string) error {
+	_, err := e.ExecContext(ctx, l.deleteSQL(), id)
+	return err
+}
+
+// Active queries the migrations table for the migration ID and returns true if a result is found.
+func (l *Log) Active(ctx context.Context, id string) (bool, error) {
+	var rowID int
+
+	err := l.Conn.QueryRowContext(ctx, l.selectSQL(), id).Scan(&rowID)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		return false, err
+	default:
+		return true, nil
+	}
+}
+
+// Applied returns all migrations in the migrations table, in the order they were applied. Columns missing from a table
+// that hasn't been upgraded are left empty in the records.
+func (l *Log) Applied(ctx context.Context) ([]Record, error) {
+	records := []Record{}
+
+	columns, err := l.columns(ctx)
+	if err != nil {
+		return records, err
+	}
+
+	selected := []string{"migration_id"}
+	for _, c := range migrationsTableColumns {
+		if columns[c.name] {
+			selected = append(selected, c.name)
+		}
+	}
+
+	rows, err := l.Conn.QueryContext(ctx, l.selectAllSQL(selected))
+	if err != nil {
+		return records, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Record
+		var appliedAt timestamp
+		var checksum, version, appliedBy sql.NullString
+		var duration sql.NullInt64
+
+		dest := map[string]interface{}{
+			"migration_id":   &r.ID,
+			"applied_at":     &appliedAt,
+			"checksum":       &checksum,
+			"duration_ms":    &duration,
+			"turtle_version": &version,
+			"applied_by":     &appliedBy,
+		}
+		values := make([]interface{}, len(selected))
+		for i, name := range selected {
+			values[i] = dest[name]
+		}
+
+		err := rows.Scan(values...)
+		if err != nil {
+			return records, err
+		}
+
+		r.AppliedAt = appliedAt.Time
+		r.Checksum = checksum.String
+		r.Duration = time.Duration(duration.Int64) * time.Millisecond
+		r.Version = version.String
+		r.AppliedBy = appliedBy.String
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// columns returns the set of columns in the migrations table. Tables created by earlier versions of turtle may not have
+// every column.
+func (l *Log) columns(ctx context.Context) (map[string]bool, error) {
+	rows, err := l.Conn.QueryContext(ctx, l.selectNoneSQL())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]bool{}
+	for _, name := range names {
+		columns[strings.ToLower(name)] = true
+	}
+
+	return columns, rows.Err()
+}
+
+// CreateTableStatement returns a statement that creates the migrations table if it's missing, for use in SQL scripts.
+func (l *Log) CreateTableStatement() string {
+	return strings.Replace(l.createTableSQL(), "CREATE TABLE", "CREATE TABLE IF NOT EXISTS", 1)
+}
+
+// InsertStatement returns a statement that inserts the migration into the migrations table, with the values inline
+// rather than as parameters, for use in SQL scripts. AppliedAt is set to the time the statement runs.
+func (l *Log) InsertStatement(r Record) string {
+	duration := "NULL"
+	if r.Duration > 0 {
+		duration = fmt.Sprint(r.Duration.Nanoseconds() / int64(time.Millisecond))
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (migration_id, applied_at, checksum, duration_ms, turtle_version, applied_by) "+
+			"VALUES (%s, CURRENT_TIMESTAMP, %s, %s, %s, %s)",
+		l.table(),
+		quoteString(r.ID),
+		nullableString(r.Checksum),
+		duration,
+		nullableString(r.Version),
+		nullableString(r.AppliedBy),
+	)
+}
+
+// DeleteStatement returns a statement that deletes the migration from the migrations table, with the ID inline rather
+// than as a parameter, for use in SQL scripts.
+func (l *Log) DeleteStatement(id string) string {
+	return fmt.Sprintf(
+		"DELETE FROM %s WHERE migration_id=%s",
+		l.table(),
+		quoteString(id),
+	)
+}
+
+// table returns the quoted migrations table name.
+func (l *Log) table() string {
+	return l.Dialect.QuoteIdentifier(l.Table)
+}
+
+// createTableSQL returns the SQL for creating the migrations table.
+func (l *Log) createTableSQL() string {
+	return l.Dialect.CreateMigrationsTableSQL(l.Table)
+}
+
+// dropTableSQL returns the SQL for dropping the migrations table.
+func (l *Log) dropTableSQL() string {
+	return fmt.Sprintf(
+		"DROP TABLE %s",
+		l.table(),
+	)
+}
+
+// insertSQL returns the SQL for inserting a new migration into the migrations table.
+func (l *Log) insertSQL() string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (migration_id, applied_at, checksum, duration_ms, turtle_version, applied_by) "+
+			"VALUES (%s, %s, %s, %s, %s, %s)",
+		l.table(),
+		l.Dialect.Placeholder(1),
+		l.Dialect.Placeholder(2),
+		l.Dialect.Placeholder(3),
+		l.Dialect.Placeholder(4),
+		l.Dialect.Placeholder(5),
+		l.Dialect.Placeholder(6),
+	)
+}
+
+// selectSQL returns the SQL for selecting a migration from the migrations table.
+func (l *Log) selectSQL() string {
+	return fmt.Sprintf(
+		"SELECT id FROM %s WHERE migration_id=%s",
+		l.table(),
+		l.Dialect.Placeholder(1),
+	)
+}
+
+// selectAllSQL returns the SQL for selecting the columns of all migrations from the migrations table.
+func (l *Log) selectAllSQL(columns []string) string {
+	return fmt.Sprintf(
+		"SELECT %s FROM %s ORDER BY id",
+		strings.Join(columns, ", "),
+		l.table(),
+	)
+}
+
+// selectNoneSQL returns the SQL for selecting no rows from the migrations table, which gives its columns.
+func (l *Log) selectNoneSQL() string {
+	return fmt.Sprintf(
+		"SELECT * FROM %s WHERE 1=0",
+		l.table(),
+	)
+}
+
+// addColumnSQL returns the SQL for adding a column to the migrations table.
+func (l *Log) addColumnSQL(name, definition string) string {
+	return fmt.Sprintf(
+		"ALTER TABLE %s ADD COLUMN %s %s",
+		l.table(),
+		name,
+		definition,
+	)
+}
+
+// updateChecksumSQL returns the SQL for updating the checksum of a migration in the migrations table.
+func (l *Log) updateChecksumSQL() string {
+	return fmt.Sprintf(
+		"UPDATE %s SET checksum=%s WHERE migration_id=%s",
+		l.table(),
+		l.Dialect.Placeholder(1),
+		l.Dialect.Placeholder(2),
+	)
+}
+
+// deleteSQL returns the SQL for deleting a migration from the migrations table.
+func (l *Log) deleteSQL() string {
+	return fmt.Sprintf(
+		"DELETE FROM %s WHERE migration_id=%s",
+		l.table(),
+		l.Dialect.Placeholder(1),
+	)
+}
+
+// timestamp scans a timestamp column, whether or not the driver has parsed it into a time.Time.
+type timestamp struct {
+	Time time.Time
+}
+
+// Scan satisfies the sql.Scanner interface.
+func (t *timestamp) Scan(value interface{}) error {
+	var err error
+
+	switch v := value.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = v
+	case []byte:
+		t.Time, err = time.Parse(timestampFormat, string(v))
+	case string:
+		t.Time, err = time.Parse(timestampFormat, v)
+	default:
+		err = fmt.Errorf("unable to scan %T into a timestamp", value)
+	}
+
+	return err
+}
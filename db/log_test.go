@@ -0,0 +1,120 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	. "github.com/nicday/turtle/db"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v0"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Log", func() {
+	var log *Log
+
+	BeforeEach(func() {
+		dialect, err := LookupDialect("postgres")
+		Expect(err).NotTo(HaveOccurred())
+
+		log = NewLog(Conn, dialect, "migrations")
+	})
+
+	Describe("#Applied", func() {
+		It("returns the migrations in the migrations table", func() {
+			appliedAt := time.Date(2015, 7, 3, 23, 43, 0, 0, time.UTC)
+
+			sqlmock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "migrations" WHERE 1=0`)).
+				WillReturnRows(sqlmock.NewRows([]string{
+					"id", "migration_id", "applied_at", "checksum", "duration_ms", "turtle_version", "applied_by",
+				}))
+			expectedSQL := `SELECT migration_id, applied_at, checksum, duration_ms, turtle_version, applied_by FROM "migrations" ORDER BY id`
+			sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+				WillReturnRows(sqlmock.NewRows([]string{
+					"migration_id", "applied_at", "checksum", "duration_ms", "turtle_version", "applied_by",
+				}).
+					AddRow("1_first", appliedAt, "abc123", 1500, "0.0.1", "deploy@web1").
+					AddRow("2_second", []byte("2015-07-03 23:43:00"), nil, nil, nil, nil))
+
+			records, err := log.Applied(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(Equal([]Record{
+				{
+					ID:        "1_first",
+					AppliedAt: appliedAt,
+					Checksum:  "abc123",
+					Duration:  1500 * time.Millisecond,
+					Version:   "0.0.1",
+					AppliedBy: "deploy@web1",
+				},
+				{ID: "2_second", AppliedAt: appliedAt},
+			}))
+		})
+
+		Context("when the migrations table has only the original columns", func() {
+			It("returns the migrations without the newer columns", func() {
+				sqlmock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "migrations" WHERE 1=0`)).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "migration_id"}))
+				expectedSQL := `SELECT migration_id FROM "migrations" ORDER BY id`
+				sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+					WillReturnRows(sqlmock.NewRows([]string{"migration_id"}).AddRow("1_first"))
+
+				records, err := log.Applied(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(records).To(Equal([]Record{{ID: "1_first"}}))
+			})
+		})
+	})
+
+	Describe("#Upgrade", func() {
+		It("adds the columns missing from the migrations table", func() {
+			mockDB, err := sqlmock.New()
+			Expect(err).NotTo(HaveOccurred())
+			mockLog := NewLog(mockDB, log.Dialect, "migrations")
+
+			sqlmock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "migrations" WHERE 1=0`)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "migration_id", "applied_at"}))
+			for _, column := range []string{
+				"checksum VARCHAR(64) NULL",
+				"duration_ms BIGINT NULL",
+				"turtle_version VARCHAR(32) NULL",
+				"applied_by VARCHAR(255) NULL",
+			} {
+				sqlmock.ExpectExec(regexp.QuoteMeta(`ALTER TABLE "migrations" ADD COLUMN ` + column)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+
+			err = mockLog.Upgrade(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			// Closing the mock connection fails if any of the expectations weren't met.
+			Expect(mockDB.Close()).To(Succeed())
+		})
+	})
+
+	Describe("#TablePresent", func() {
+		It("returns true when the table is in the database", func() {
+			expectedSQL := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+			sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+				WithArgs("migrations").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+			present, err := log.TablePresent(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(present).To(BeTrue())
+		})
+
+		It("looks in the schema of a qualified table name", func() {
+			expectedSQL := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = $1 AND table_name = $2"
+			sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+				WithArgs("billing", "migrations").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+			present, err := NewLog(Conn, log.Dialect, "billing.migrations").TablePresent(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(present).To(BeFalse())
+		})
+	})
+})
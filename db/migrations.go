@@ -1,32 +1,24 @@
 package db
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
 	"log"
-
-	"github.com/nicday/turtle/config"
 )
 
-// MigrationsTablePresent returns true if the migrations is not present in the database.
+// MigrationsTablePresent returns true if the migrations table is present in the database.
 func MigrationsTablePresent() bool {
-	_, err := Conn.Exec(migrationsTablePresentSQL())
+	present, err := DefaultLog().TablePresent(context.Background())
 	if err != nil {
+		log.Println(err)
 		return false
 	}
 
-	return true
+	return present
 }
 
 // CreateMigrationsTable creates the migrations table in the database.
 func CreateMigrationsTable() error {
-	query, err := Conn.Prepare(createMigrationsTableSQL())
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-
-	_, err = query.Exec()
+	err := DefaultLog().CreateTable(context.Background())
 	if err != nil {
 		log.Println(err)
 		return err
@@ -37,13 +29,7 @@ func CreateMigrationsTable() error {
 
 // DropMigrationsTable drops the migrations table from the database.
 func DropMigrationsTable() error {
-	query, err := Conn.Prepare(dropMigrationsTableSQL())
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-
-	_, err = query.Exec()
+	err := DefaultLog().DropTable(context.Background())
 	if err != nil {
 		log.Println(err)
 		return err
@@ -54,13 +40,7 @@ func DropMigrationsTable() error {
 
 // InsertMigration inserts a new migration into the migrations table.
 func InsertMigration(id string) error {
-	query, err := Conn.Prepare(insertMigrationSQL())
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-
-	_, err = query.Exec(id)
+	err := DefaultLog().Insert(context.Background(), Record{ID: id})
 	if err != nil {
 		log.Println(err)
 		return err
@@ -71,13 +51,7 @@ func InsertMigration(id string) error {
 
 // DeleteMigration deletes a migration from the migrations table.
 func DeleteMigration(id string) error {
-	query, err := Conn.Prepare(deleteMigrationSQL())
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-
-	_, err = query.Exec(id)
+	err := DefaultLog().Delete(context.Background(), id)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -88,70 +62,22 @@ func DeleteMigration(id string) error {
 
 // MigrationActive queries the migrations table for the migration ID and returns true if a result is found.
 func MigrationActive(id string) (bool, error) {
-	query, err := Conn.Prepare(selectMigrationSQL())
+	active, err := DefaultLog().Active(context.Background(), id)
 	if err != nil {
 		log.Println(err)
 		return false, err
 	}
 
-	var rowID int
+	return active, nil
+}
 
-	err = query.QueryRow(id).Scan(&rowID)
-	switch {
-	case err == sql.ErrNoRows:
-		return false, nil
-	case err != nil:
+// ForceUnlock clears the migration lock, whichever process holds it.
+func ForceUnlock() error {
+	err := DefaultLog().ForceUnlock(context.Background())
+	if err != nil {
 		log.Println(err)
-		return false, err
-	default:
-		return true, nil
+		return err
 	}
-}
-
-// migrationsTablePresentSQL returns the SQL for checking if the migrations table is present.
-func migrationsTablePresentSQL() string {
-	return fmt.Sprintf(
-		"SELECT 1 FROM %s LIMIT 1",
-		config.MigrationsTableName,
-	)
-}
 
-// createMigrationsTableSQL returns the SQL for creating the migrations table.
-func createMigrationsTableSQL() string {
-	return fmt.Sprintf(
-		"CREATE TABLE %s (id INT NOT NULL AUTO_INCREMENT, migration_id VARCHAR(255) NOT NULL UNIQUE, PRIMARY KEY(id))",
-		config.MigrationsTableName,
-	)
-}
-
-// dropMigrationsTableSQL returns the SQL for dropping the migrations table.
-func dropMigrationsTableSQL() string {
-	return fmt.Sprintf(
-		"DROP TABLE %s",
-		config.MigrationsTableName,
-	)
-}
-
-// insertMigrationSQL returns the SQL for inserting a new migration into the migrations table.
-func insertMigrationSQL() string {
-	return fmt.Sprintf(
-		"INSERT INTO %s (migration_id) VALUES (?)",
-		config.MigrationsTableName,
-	)
-}
-
-// selectMigrationSQL returns the SQL for selecting a migration from the migrations table.
-func selectMigrationSQL() string {
-	return fmt.Sprintf(
-		"SELECT id FROM %s WHERE migration_id=?",
-		config.MigrationsTableName,
-	)
-}
-
-// deleteMigrationSQL returns the SQL for deleting a migration from the migrations table.
-func deleteMigrationSQL() string {
-	return fmt.Sprintf(
-		"DELETE FROM %s WHERE migration_id=?",
-		config.MigrationsTableName,
-	)
+	return nil
 }
@@ -2,6 +2,7 @@ package db_test
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"regexp"
 
@@ -23,6 +24,10 @@ var _ = Describe("db", func() {
 
 	Conn = mockDB
 
+	BeforeEach(func() {
+		config.DBDriver = "mysql"
+	})
+
 	// TODO: default is not actually using the default
 	tableNames := map[string]string{
 		"the default": "migrations",
@@ -33,10 +38,30 @@ var _ = Describe("db", func() {
 		config.MigrationsTableName = tableName
 
 		Context(fmt.Sprintf("with %s table name", desc), func() {
+			Describe(".MigrationsTablePresent", func() {
+				It("returns true when the table is in the database", func() {
+					expectedSQL := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+					sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+						WithArgs(config.MigrationsTableName).
+						WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+					Expect(MigrationsTablePresent()).To(BeTrue())
+				})
+
+				It("returns false when the table isn't in the database", func() {
+					expectedSQL := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+					sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+						WithArgs(config.MigrationsTableName).
+						WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+					Expect(MigrationsTablePresent()).To(BeFalse())
+				})
+			})
+
 			Describe(".CreateMigrationsTable", func() {
 				It("creates the migration table in the database", func() {
 					expectedSQL := fmt.Sprintf(
-						"CREATE TABLE %s (id INT NOT NULL AUTO_INCREMENT, migration_id VARCHAR(255) NOT NULL UNIQUE, PRIMARY KEY(id))",
+						"CREATE TABLE `%s` (id INT NOT NULL AUTO_INCREMENT, migration_id VARCHAR(255) NOT NULL UNIQUE, applied_at TIMESTAMP NULL, checksum VARCHAR(64) NULL, duration_ms BIGINT NULL, turtle_version VARCHAR(32) NULL, applied_by VARCHAR(255) NULL, PRIMARY KEY(id))",
 						config.MigrationsTableName,
 					)
 					sqlmock.ExpectExec(regexp.QuoteMeta(expectedSQL)).
@@ -51,7 +76,7 @@ var _ = Describe("db", func() {
 			Describe(".DropMigrationsTable", func() {
 				It("drops the migration table in the database", func() {
 					expectedSQL := fmt.Sprintf(
-						"DROP TABLE %s",
+						"DROP TABLE `%s`",
 						config.MigrationsTableName,
 					)
 					sqlmock.ExpectExec(regexp.QuoteMeta(expectedSQL)).
@@ -66,11 +91,12 @@ var _ = Describe("db", func() {
 				It("inserts a migration in the migration table", func() {
 					ID := "123"
 					expectedSQL := fmt.Sprintf(
-						"INSERT INTO %s (migration_id) VALUES (?)",
+						"INSERT INTO `%s` (migration_id, applied_at, checksum, duration_ms, turtle_version, applied_by) "+
+							"VALUES (?, ?, ?, ?, ?, ?)",
 						config.MigrationsTableName,
 					)
 					sqlmock.ExpectExec(regexp.QuoteMeta(expectedSQL)).
-						WithArgs(ID).
+						WithArgs(ID, anyArg{}, "", 0, "", "").
 						WillReturnResult(sqlmock.NewResult(0, 0))
 
 					err := InsertMigration(ID)
@@ -82,7 +108,7 @@ var _ = Describe("db", func() {
 				It("deletes a migration from the migration table", func() {
 					ID := "123"
 					expectedSQL := fmt.Sprintf(
-						"DELETE FROM %s WHERE migration_id=?",
+						"DELETE FROM `%s` WHERE migration_id=?",
 						config.MigrationsTableName,
 					)
 					sqlmock.ExpectExec(regexp.QuoteMeta(expectedSQL)).
@@ -99,7 +125,7 @@ var _ = Describe("db", func() {
 					It("returns true", func() {
 						ID := "123"
 						expectedSQL := fmt.Sprintf(
-							"SELECT id FROM %s WHERE migration_id=?",
+							"SELECT id FROM `%s` WHERE migration_id=?",
 							config.MigrationsTableName,
 						)
 						sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
@@ -117,7 +143,7 @@ var _ = Describe("db", func() {
 					It("returns false", func() {
 						ID := "123"
 						expectedSQL := fmt.Sprintf(
-							"SELECT id FROM %s WHERE migration_id=?",
+							"SELECT id FROM `%s` WHERE migration_id=?",
 							config.MigrationsTableName,
 						)
 						sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
@@ -133,4 +159,49 @@ var _ = Describe("db", func() {
 			})
 		})
 	}
+
+	Context("with DB_DRIVER=postgres", func() {
+		BeforeEach(func() {
+			config.DBDriver = "postgres"
+		})
+
+		Describe(".CreateMigrationsTable", func() {
+			It("creates the migration table with a serial primary key", func() {
+				expectedSQL := fmt.Sprintf(
+					"CREATE TABLE \"%s\" (id SERIAL PRIMARY KEY, migration_id VARCHAR(255) NOT NULL UNIQUE, applied_at TIMESTAMP NULL, checksum VARCHAR(64) NULL, duration_ms BIGINT NULL, turtle_version VARCHAR(32) NULL, applied_by VARCHAR(255) NULL)",
+					config.MigrationsTableName,
+				)
+				sqlmock.ExpectExec(regexp.QuoteMeta(expectedSQL)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err := CreateMigrationsTable()
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Describe(".InsertMigration", func() {
+			It("uses numbered placeholders", func() {
+				ID := "123"
+				expectedSQL := fmt.Sprintf(
+					"INSERT INTO \"%s\" (migration_id, applied_at, checksum, duration_ms, turtle_version, applied_by) "+
+						"VALUES ($1, $2, $3, $4, $5, $6)",
+					config.MigrationsTableName,
+				)
+				sqlmock.ExpectExec(regexp.QuoteMeta(expectedSQL)).
+					WithArgs(ID, anyArg{}, "", 0, "", "").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				err := InsertMigration(ID)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	})
 })
+
+// anyArg matches any query argument, for values such as timestamps that can't be predicted.
+type anyArg struct{}
+
+// Match satisfies the sqlmock.Argument interface.
+func (anyArg) Match(driver.Value) bool {
+	return true
+}
@@ -0,0 +1,384 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrSchemaNotSupported is raised when dumping the schema of a database whose dialect doesn't implement SchemaDumper.
+var ErrSchemaNotSupported = errors.New("the database driver doesn't support dumping the schema")
+
+// postgresNotInExtension is a condition that the object with the OID isn't part of an extension.
+const postgresNotInExtension = "NOT EXISTS (SELECT 1 FROM pg_depend e WHERE e.objid = %s AND e.deptype = 'e')"
+
+// The catalog queries for the PostgreSQL objects other than tables and sequences, each returns the statements that
+// create the objects in the current schema.
+var (
+	postgresExtensionsSQL = "SELECT format('CREATE EXTENSION IF NOT EXISTS %I WITH SCHEMA %I', x.extname, n.nspname) " +
+		"FROM pg_extension x JOIN pg_namespace n ON n.oid = x.extnamespace WHERE x.extname <> 'plpgsql' ORDER BY x.extname"
+
+	postgresEnumsSQL = "SELECT format('CREATE TYPE %I AS ENUM (%s)', t.typname, " +
+		"string_agg(quote_literal(v.enumlabel), ', ' ORDER BY v.enumsortorder)) " +
+		"FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace JOIN pg_enum v ON v.enumtypid = t.oid " +
+		"WHERE n.nspname = current_schema() AND " + fmt.Sprintf(postgresNotInExtension, "t.oid") + " " +
+		"GROUP BY t.typname ORDER BY t.typname"
+
+	postgresDomainsSQL = "SELECT format('CREATE DOMAIN %I AS %s', t.typname, format_type(t.typbasetype, t.typtypmod)) " +
+		"|| COALESCE(' DEFAULT ' || t.typdefault, '') || CASE WHEN t.typnotnull THEN ' NOT NULL' ELSE '' END " +
+		"|| COALESCE((SELECT string_agg(format(' CONSTRAINT %I %s', c.conname, pg_get_constraintdef(c.oid)), '' " +
+		"ORDER BY c.conname) FROM pg_constraint c WHERE c.contypid = t.oid), '') " +
+		"FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace " +
+		"WHERE t.typtype = 'd' AND n.nspname = current_schema() AND " + fmt.Sprintf(postgresNotInExtension, "t.oid") + " " +
+		"ORDER BY t.typname"
+
+	postgresCompositesSQL = "SELECT format('CREATE TYPE %I AS (%s)', t.typname, " +
+		"string_agg(format('%I %s', a.attname, format_type(a.atttypid, a.atttypmod)), ', ' ORDER BY a.attnum)) " +
+		"FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace JOIN pg_class c ON c.oid = t.typrelid " +
+		"JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped " +
+		"WHERE t.typtype = 'c' AND c.relkind = 'c' AND n.nspname = current_schema() AND " +
+		fmt.Sprintf(postgresNotInExtension, "t.oid") + " GROUP BY t.typname ORDER BY t.typname"
+
+	postgresFunctionsSQL = "SELECT pg_get_functiondef(p.oid) FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace " +
+		"WHERE p.prokind IN ('f', 'p') AND n.nspname = current_schema() AND " +
+		fmt.Sprintf(postgresNotInExtension, "p.oid") + " ORDER BY p.proname, p.oid"
+
+	// Views are created in the order they were, so that views are created after the views they select from.
+	postgresViewsSQL = "SELECT format(CASE c.relkind WHEN 'm' THEN 'CREATE MATERIALIZED VIEW %I AS %s' " +
+		"ELSE 'CREATE VIEW %I AS %s' END, c.relname, rtrim(rtrim(pg_get_viewdef(c.oid)), ';')) " +
+		"FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace " +
+		"WHERE c.relkind IN ('v', 'm') AND n.nspname = current_schema() AND " +
+		fmt.Sprintf(postgresNotInExtension, "c.oid") + " ORDER BY c.oid"
+)
+
+// mysqlAutoIncrementRegex matches the AUTO_INCREMENT table option, which changes as rows are inserted.
+var mysqlAutoIncrementRegex = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
+// Queryer runs a query, it is implemented by *sql.DB and *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// SchemaDumper is implemented by dialects that can dump the schema of the current database. The statements are
+// returned in an order that recreates the schema in an empty database, without the tables in exclude.
+type SchemaDumper interface {
+	DumpSchema(ctx context.Context, q Queryer, exclude map[string]bool) ([]string, error)
+}
+
+// DumpSchema returns the statements that recreate the schema of the database, without the migrations and lock tables.
+func (l *Log) DumpSchema(ctx context.Context) ([]string, error) {
+	d, ok := l.Dialect.(SchemaDumper)
+	if !ok {
+		return nil, ErrSchemaNotSupported
+	}
+
+	table := unqualified(l.Table)
+	return d.DumpSchema(ctx, l.Conn, map[string]bool{table: true, table + "_lock": true})
+}
+
+// DumpSchema returns the CREATE TABLE statement of each table from SHOW CREATE TABLE. Foreign key checks are disabled
+// while the tables are created, so that they can reference tables created after them.
+func (d mysqlDialect) DumpSchema(ctx context.Context, q Queryer, exclude map[string]bool) ([]string, error) {
+	tables, err := queryStrings(ctx, q,
+		"SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' "+
+			"ORDER BY table_name",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []string{"SET FOREIGN_KEY_CHECKS = 0"}
+	for _, table := range tables {
+		if exclude[table] {
+			continue
+		}
+
+		var name, create string
+		err := queryRow(ctx, q, fmt.Sprintf("SHOW CREATE TABLE %s", d.QuoteIdentifier(table)), &name, &create)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, mysqlAutoIncrementRegex.ReplaceAllString(create, ""))
+	}
+
+	return append(statements, "SET FOREIGN_KEY_CHECKS = 1"), nil
+}
+
+// DumpSchema builds the current schema from the catalog, in the order pg_dump would create it: the extensions, the
+// enum, domain and composite types, the sequences that aren't owned by identity columns, the functions, each table with
+// its columns, then the table constraints with foreign keys last, the indexes that don't back a constraint, the views
+// and the triggers. Objects that belong to an extension are created by the extension. Function bodies aren't checked
+// while loading, as they can refer to tables created after them.
+func (d postgresDialect) DumpSchema(ctx context.Context, q Queryer, exclude map[string]bool) ([]string, error) {
+	statements := []string{"SET check_function_bodies = false"}
+	for _, query := range []string{postgresExtensionsSQL, postgresEnumsSQL, postgresDomainsSQL, postgresCompositesSQL} {
+		created, err := queryStrings(ctx, q, query)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, created...)
+	}
+
+	sequences, err := d.createSequences(ctx, q, exclude)
+	if err != nil {
+		return nil, err
+	}
+	statements = append(statements, sequences...)
+
+	functions, err := queryStrings(ctx, q, postgresFunctionsSQL)
+	if err != nil {
+		return nil, err
+	}
+	statements = append(statements, functions...)
+
+	tables, err := queryStrings(ctx, q,
+		"SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() "+
+			"AND table_type = 'BASE TABLE' ORDER BY table_name",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	constraints := []string{}
+	foreignKeys := []string{}
+	indexes := []string{}
+	for _, table := range tables {
+		if exclude[table] {
+			continue
+		}
+
+		create, err := d.createTable(ctx, q, table)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, create)
+
+		rows, err := q.QueryContext(ctx,
+			"SELECT conname, contype, pg_get_constraintdef(oid) FROM pg_constraint "+
+				"WHERE conrelid = $1::regclass AND contype IN ('p', 'u', 'c', 'f', 'x') ORDER BY conname",
+			d.QuoteIdentifier(table),
+		)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var name, kind, definition string
+			err := rows.Scan(&name, &kind, &definition)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			constraint := fmt.Sprintf(
+				"ALTER TABLE %s ADD CONSTRAINT %s %s", d.QuoteIdentifier(table), d.QuoteIdentifier(name), definition,
+			)
+			if kind == "f" {
+				foreignKeys = append(foreignKeys, constraint)
+			} else {
+				constraints = append(constraints, constraint)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		tableIndexes, err := queryStrings(ctx, q,
+			"SELECT indexdef FROM pg_indexes WHERE schemaname = current_schema() AND tablename = $1 "+
+				"AND indexname NOT IN (SELECT conname FROM pg_constraint WHERE conrelid = $2::regclass) ORDER BY indexname",
+			table, d.QuoteIdentifier(table),
+		)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, tableIndexes...)
+	}
+
+	statements = append(statements, constraints...)
+	statements = append(statements, foreignKeys...)
+	statements = append(statements, indexes...)
+
+	views, err := queryStrings(ctx, q, postgresViewsSQL)
+	if err != nil {
+		return nil, err
+	}
+	statements = append(statements, views...)
+
+	triggers, err := d.createTriggers(ctx, q, exclude)
+	if err != nil {
+		return nil, err
+	}
+	return append(statements, triggers...), nil
+}
+
+// createTriggers returns the statements that create the triggers, other than those on the excluded tables.
+func (d postgresDialect) createTriggers(ctx context.Context, q Queryer, exclude map[string]bool) ([]string, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT c.relname, pg_get_triggerdef(t.oid) FROM pg_trigger t "+
+			"JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace "+
+			"WHERE NOT t.tgisinternal AND n.nspname = current_schema() ORDER BY c.relname, t.tgname",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statements := []string{}
+	for rows.Next() {
+		var table, trigger string
+		err := rows.Scan(&table, &trigger)
+		if err != nil {
+			return nil, err
+		}
+		if !exclude[table] {
+			statements = append(statements, trigger)
+		}
+	}
+
+	return statements, rows.Err()
+}
+
+// createSequences returns the statements that create the sequences, other than those owned by identity columns or the
+// excluded tables.
+func (d postgresDialect) createSequences(ctx context.Context, q Queryer, exclude map[string]bool) ([]string, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT c.relname, COALESCE(owner.relname, '') FROM pg_class c "+
+			"JOIN pg_namespace n ON n.oid = c.relnamespace "+
+			"LEFT JOIN pg_depend dep ON dep.objid = c.oid AND dep.classid = 'pg_class'::regclass AND dep.deptype = 'a' "+
+			"LEFT JOIN pg_class owner ON owner.oid = dep.refobjid "+
+			"WHERE c.relkind = 'S' AND n.nspname = current_schema() "+
+			"AND NOT EXISTS (SELECT 1 FROM pg_depend i WHERE i.objid = c.oid AND i.deptype = 'i') "+
+			"ORDER BY c.relname",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statements := []string{}
+	for rows.Next() {
+		var sequence, owner string
+		err := rows.Scan(&sequence, &owner)
+		if err != nil {
+			return nil, err
+		}
+		if !exclude[owner] {
+			statements = append(statements, fmt.Sprintf("CREATE SEQUENCE %s", d.QuoteIdentifier(sequence)))
+		}
+	}
+
+	return statements, rows.Err()
+}
+
+// createTable builds the CREATE TABLE statement for the table's columns, with their types, defaults and identity.
+func (d postgresDialect) createTable(ctx context.Context, q Queryer, table string) (string, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull, "+
+			"COALESCE(pg_get_expr(def.adbin, def.adrelid), ''), a.attidentity::text "+
+			"FROM pg_attribute a LEFT JOIN pg_attrdef def ON def.adrelid = a.attrelid AND def.adnum = a.attnum "+
+			"WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum",
+		d.QuoteIdentifier(table),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var name, kind, def, identity string
+		var notNull bool
+		err := rows.Scan(&name, &kind, &notNull, &def, &identity)
+		if err != nil {
+			return "", err
+		}
+
+		column := d.QuoteIdentifier(name) + " " + kind
+		switch identity {
+		case "a":
+			column += " GENERATED ALWAYS AS IDENTITY"
+		case "d":
+			column += " GENERATED BY DEFAULT AS IDENTITY"
+		}
+		if def != "" {
+			column += " DEFAULT " + def
+		}
+		if notNull {
+			column += " NOT NULL"
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", d.QuoteIdentifier(table), strings.Join(columns, ",\n  ")), nil
+}
+
+// DumpSchema returns the SQL SQLite recorded for each table, followed by the indexes, views and triggers.
+func (sqliteDialect) DumpSchema(ctx context.Context, q Queryer, exclude map[string]bool) ([]string, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT tbl_name, sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' "+
+			"ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 ELSE 2 END, name",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statements := []string{}
+	for rows.Next() {
+		var table, statement string
+		err := rows.Scan(&table, &statement)
+		if err != nil {
+			return nil, err
+		}
+		if !exclude[table] {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements, rows.Err()
+}
+
+// queryStrings returns the first column of each row of the query.
+func queryStrings(ctx context.Context, q Queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// queryRow scans the single row of the query into dest.
+func queryRow(ctx context.Context, q Queryer, query string, dest ...interface{}) error {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	return rows.Scan(dest...)
+}
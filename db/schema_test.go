@@ -0,0 +1,90 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+
+	. "github.com/nicday/turtle/db"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v0"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("schema", func() {
+	Describe("#DumpSchema", func() {
+		It("returns SHOW CREATE TABLE for each table other than the migrations and lock tables", func() {
+			dialect, err := LookupDialect("mysql")
+			Expect(err).NotTo(HaveOccurred())
+			log := NewLog(Conn, dialect, "migrations")
+
+			sqlmock.ExpectQuery(regexp.QuoteMeta("SELECT table_name FROM information_schema.tables")).
+				WillReturnRows(sqlmock.NewRows([]string{"table_name"}).
+					AddRow("migrations").
+					AddRow("migrations_lock").
+					AddRow("users"))
+			sqlmock.ExpectQuery(regexp.QuoteMeta("SHOW CREATE TABLE `users`")).
+				WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).
+					AddRow("users", "CREATE TABLE `users` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB AUTO_INCREMENT=42 DEFAULT CHARSET=utf8mb4"))
+
+			statements, err := log.DumpSchema(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(Equal([]string{
+				"SET FOREIGN_KEY_CHECKS = 0",
+				"CREATE TABLE `users` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+				"SET FOREIGN_KEY_CHECKS = 1",
+			}))
+		})
+
+		It("returns the extensions, types, functions, tables, views and triggers of the current postgres schema", func() {
+			dialect, err := LookupDialect("postgres")
+			Expect(err).NotTo(HaveOccurred())
+			log := NewLog(Conn, dialect, "migrations")
+
+			expectStrings := func(query string, values ...string) {
+				rows := sqlmock.NewRows([]string{"statement"})
+				for _, value := range values {
+					rows = rows.AddRow(value)
+				}
+				sqlmock.ExpectQuery(regexp.QuoteMeta(query)).WillReturnRows(rows)
+			}
+
+			expectStrings("SELECT format('CREATE EXTENSION", `CREATE EXTENSION IF NOT EXISTS citext WITH SCHEMA public`)
+			expectStrings("SELECT format('CREATE TYPE %I AS ENUM", `CREATE TYPE mood AS ENUM ('sad', 'happy')`)
+			expectStrings("SELECT format('CREATE DOMAIN", `CREATE DOMAIN email AS citext NOT NULL`)
+			expectStrings("SELECT format('CREATE TYPE %I AS (")
+			sqlmock.ExpectQuery(regexp.QuoteMeta("SELECT c.relname, COALESCE(owner.relname, '')")).
+				WillReturnRows(sqlmock.NewRows([]string{"relname", "owner"}))
+			expectStrings("SELECT pg_get_functiondef",
+				"CREATE OR REPLACE FUNCTION public.touch()\n RETURNS trigger\n LANGUAGE plpgsql\nAS $function$BEGIN RETURN NEW; END$function$\n")
+			expectStrings("SELECT table_name FROM information_schema.tables", "migrations", "users")
+			sqlmock.ExpectQuery(regexp.QuoteMeta("SELECT a.attname")).
+				WillReturnRows(sqlmock.NewRows([]string{"attname", "type", "notnull", "default", "identity"}).
+					AddRow("id", "integer", true, "", "a").
+					AddRow("mood", "mood", false, "", ""))
+			sqlmock.ExpectQuery(regexp.QuoteMeta("SELECT conname, contype")).
+				WillReturnRows(sqlmock.NewRows([]string{"conname", "contype", "definition"}).
+					AddRow("users_pkey", "p", "PRIMARY KEY (id)"))
+			expectStrings("SELECT indexdef")
+			expectStrings("SELECT format(CASE c.relkind", `CREATE VIEW happy_users AS SELECT users.id FROM users WHERE users.mood = 'happy'::mood`)
+			sqlmock.ExpectQuery(regexp.QuoteMeta("SELECT c.relname, pg_get_triggerdef")).
+				WillReturnRows(sqlmock.NewRows([]string{"relname", "definition"}).
+					AddRow("migrations", "CREATE TRIGGER audit AFTER INSERT ON public.migrations FOR EACH ROW EXECUTE FUNCTION touch()").
+					AddRow("users", "CREATE TRIGGER touch BEFORE UPDATE ON public.users FOR EACH ROW EXECUTE FUNCTION touch()"))
+
+			statements, err := log.DumpSchema(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(Equal([]string{
+				"SET check_function_bodies = false",
+				`CREATE EXTENSION IF NOT EXISTS citext WITH SCHEMA public`,
+				`CREATE TYPE mood AS ENUM ('sad', 'happy')`,
+				`CREATE DOMAIN email AS citext NOT NULL`,
+				"CREATE OR REPLACE FUNCTION public.touch()\n RETURNS trigger\n LANGUAGE plpgsql\nAS $function$BEGIN RETURN NEW; END$function$\n",
+				"CREATE TABLE \"users\" (\n  \"id\" integer GENERATED ALWAYS AS IDENTITY NOT NULL,\n  \"mood\" mood\n)",
+				`ALTER TABLE "users" ADD CONSTRAINT "users_pkey" PRIMARY KEY (id)`,
+				`CREATE VIEW happy_users AS SELECT users.id FROM users WHERE users.mood = 'happy'::mood`,
+				"CREATE TRIGGER touch BEFORE UPDATE ON public.users FOR EACH ROW EXECUTE FUNCTION touch()",
+			}))
+		})
+	})
+})
@@ -0,0 +1,58 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// directiveRegex matches a `-- turtle:<directive>` comment.
+var directiveRegex = regexp.MustCompile(`^--\s*turtle:(.*)$`)
+
+// directives are the options a migration sets with `-- turtle:<directive>` comments in its header, the comment lines
+// before its first statement.
+type directives struct {
+	// noTransaction is set with `-- turtle:no-transaction`, the migration runs outside a transaction. This is needed
+	// for statements that can't run in a transaction, such as CREATE INDEX CONCURRENTLY in PostgreSQL.
+	noTransaction bool
+
+	// transactionAll is set with `-- turtle:transaction all`, the whole up run containing the migration runs in a
+	// single transaction, as with config.TransactionAll.
+	transactionAll bool
+}
+
+// parseDirectives returns the directives in the migration's header. Unknown directives are an error, so that a typo
+// doesn't silently run a migration in the wrong mode.
+func parseDirectives(query string) (directives, error) {
+	d := directives{}
+
+	for i, line := range strings.Split(query, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		match := directiveRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		switch directive := strings.Join(strings.Fields(match[1]), " "); directive {
+		case "no-transaction":
+			d.noTransaction = true
+		case "transaction all":
+			d.transactionAll = true
+		default:
+			return d, fmt.Errorf("line %d: unknown directive turtle:%s", i+1, directive)
+		}
+	}
+
+	if d.noTransaction && d.transactionAll {
+		return d, fmt.Errorf("turtle:no-transaction and turtle:transaction all can't be used together")
+	}
+
+	return d, nil
+}
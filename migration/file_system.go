@@ -6,11 +6,17 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
+	"sort"
+	"strings"
 	"time"
 )
 
+// OS is the FileSystem of the operating system.
+var OS FileSystem = osFS{}
+
 // FS is the active FileSystem
-var FS FileSystem = osFS{}
+var FS = OS
 
 // FileSystem is a generic interface for a file system.
 type FileSystem interface {
@@ -36,6 +42,42 @@ func (osFS) Open(name string) (File, error)        { return os.Open(name) }
 func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
 func (osFS) ReadFile(name string) ([]byte, error)  { return ioutil.ReadFile(name) }
 
+// walk returns the paths of the files in dir and its subdirectories, in lexical order. Hidden directories, such as
+// `.git`, are skipped.
+func walk(fs FileSystem, dir string) ([]string, error) {
+	f, err := fs.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	infos, err := f.Readdir(0)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	paths := []string{}
+	for _, info := range infos {
+		p := path.Join(dir, info.Name())
+		if !info.IsDir() {
+			paths = append(paths, p)
+			continue
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+
+		nested, err := walk(fs, p)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, nested...)
+	}
+
+	return paths, nil
+}
+
 // MockFS is a concrete implementation of the File interface.
 type MockFS struct {
 	Files map[string]MockFile
@@ -66,8 +108,11 @@ func (m *MockFS) AddFiles(path string, files ...MockFile) error {
 			if err != nil {
 				return err
 			}
-			m.AddFiles(fmt.Sprintf("%s%s/", path, info.Name()), file.Files...)
-			return nil
+			err = m.AddFiles(fmt.Sprintf("%s%s/", path, info.Name()), file.Files...)
+			if err != nil {
+				return err
+			}
+			continue
 		}
 
 		m.Files[fmt.Sprintf("%s%s", path, info.Name())] = file
@@ -156,6 +201,11 @@ func (m MockFile) Readdir(n int) ([]os.FileInfo, error) {
 	return infos, nil
 }
 
+// Close satisfies the File interface. There is nothing to release.
+func (m MockFile) Close() error {
+	return nil
+}
+
 // Content returns the file contents.
 func (m MockFile) Content() []byte {
 	return m.content
@@ -2,8 +2,10 @@ package migration
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,23 +16,76 @@ const (
 	timeFormat = "20060102150405.000"
 )
 
+// GenerateOptions selects the form and contents of generated migration files.
+type GenerateOptions struct {
+	// Single generates one file with `-- +turtle Up` and `-- +turtle Down` sections, rather than up and down files.
+	Single bool
+
+	// Template is the name of the template to render the SQL from, the files are empty without one.
+	Template string
+
+	// Table and Columns are passed to the template.
+	Table   string
+	Columns []Column
+
+	// IDScheme is how the migration is numbered, defaults to config.IDScheme.
+	IDScheme string
+}
+
 // Generate creates up and down migration files.
 func Generate(name string) error {
-	assertMigrationDir()
+	return GenerateWith(name, GenerateOptions{})
+}
+
+// GenerateWith creates the migration files for the options.
+func GenerateWith(name string, opts GenerateOptions) error {
+	err := assertMigrationDir()
+	if err != nil {
+		return err
+	}
+
+	ts, err := nextID(opts.IDScheme)
+	if err != nil {
+		return err
+	}
+
+	up, down := "", ""
+	if opts.Template != "" {
+		up, down, err = renderTemplate(opts.Template, TemplateData{
+			Name:      name,
+			Timestamp: ts,
+			Dialect:   config.DBDriver,
+			Table:     opts.Table,
+			Columns:   opts.Columns,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	baseFilename := fmt.Sprintf("%s_%s", ts, name)
 
-	baseFilename := fmt.Sprintf("%s_%s", timestamp(), name)
+	if opts.Single {
+		return createMigrationFile(baseFilename+".sql", fmt.Sprintf(
+			"-- +turtle Up\n%s\n\n-- +turtle Down\n%s\n", strings.TrimSpace(up), strings.TrimSpace(down),
+		))
+	}
 
+	contents := map[string]string{"up": up, "down": down}
 	for _, direction := range []string{"up", "down"} {
 		filename := fmt.Sprintf("%s_%s.sql", baseFilename, direction)
-		createMigrationFile(filename)
+		err := createMigrationFile(filename, contents[direction])
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// createMigrationFile creates the migration file in the migration directory.
-func createMigrationFile(name string) error {
-	_, err := os.Create(path.Join(config.MigrationsPath, name))
+// createMigrationFile creates the migration file in the migration directory with the contents.
+func createMigrationFile(name string, contents string) error {
+	err := ioutil.WriteFile(path.Join(config.MigrationsPath, name), []byte(contents), 0644)
 	if err != nil {
 		fmt.Println(err)
 		return err
@@ -51,8 +106,51 @@ func assertMigrationDir() error {
 	return nil
 }
 
-// timestamp returns a timestamp with millisecond accuracy and no decimal place.
-func timestamp() string {
-	t := time.Now().Format(timeFormat)
-	return strings.Replace(t, ".", "", 1)
+// nextID returns the version prefix of a new migration for the ID scheme, or config.IDScheme if it's empty.
+func nextID(scheme string) (string, error) {
+	if scheme == "" {
+		scheme = config.IDScheme
+	}
+
+	switch scheme {
+	case config.IDSchemeTimestamp:
+		return timestamp(time.Now()), nil
+	case config.IDSchemeUTC:
+		return timestamp(time.Now().UTC()), nil
+	case config.IDSchemeSequential:
+		return sequence()
+	default:
+		return "", config.ErrInvalidIDScheme
+	}
+}
+
+// timestamp returns the time with millisecond accuracy and no decimal place.
+func timestamp(t time.Time) string {
+	return strings.Replace(t.Format(timeFormat), ".", "", 1)
+}
+
+// sequence returns the version after the highest version in the migration directory, zero padded to config.IDPadding
+// digits. The first migration is 1.
+func sequence() (string, error) {
+	files, err := walk(OS, config.MigrationsPath)
+	if err != nil {
+		return "", err
+	}
+
+	latest := uint64(0)
+	for _, file := range files {
+		name := path.Base(file)
+		if !valid(name) {
+			continue
+		}
+		version, err := strconv.ParseUint(migrationVersion(name), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("unable to number the migration after %s: %v", name, err)
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+
+	return fmt.Sprintf("%0*d", config.IDPadding, latest+1), nil
 }
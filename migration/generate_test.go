@@ -1,14 +1,188 @@
 package migration_test
 
 import (
-	// . "github.com/nicday/turtle/migration"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/nicday/turtle/config"
+	. "github.com/nicday/turtle/migration"
 
 	. "github.com/onsi/ginkgo"
-	// . "github.com/onsi/gomega"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("migration", func() {
+	var (
+		dir                   string
+		previousPath          string
+		previousTemplatesPath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "turtle")
+		Expect(err).NotTo(HaveOccurred())
+
+		previousPath = config.MigrationsPath
+		previousTemplatesPath = config.TemplatesPath
+		config.MigrationsPath = path.Join(dir, "migrations")
+		config.TemplatesPath = path.Join(dir, "templates")
+	})
+
+	AfterEach(func() {
+		config.MigrationsPath = previousPath
+		config.TemplatesPath = previousTemplatesPath
+		config.DBDriver = "mysql"
+		os.RemoveAll(dir)
+	})
+
+	// generated returns the contents of the generated file with the suffix.
+	generated := func(suffix string) string {
+		matches, err := filepath.Glob(path.Join(config.MigrationsPath, "*_"+suffix))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matches).To(HaveLen(1))
+
+		contents, err := ioutil.ReadFile(matches[0])
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
 	Describe(".Generate", func() {
+		It("creates empty up and down files", func() {
+			Expect(Generate("users")).To(Succeed())
+
+			Expect(generated("users_up.sql")).To(BeEmpty())
+			Expect(generated("users_down.sql")).To(BeEmpty())
+		})
+	})
+
+	Describe(".GenerateWith", func() {
+		It("creates a single file with up and down sections", func() {
+			Expect(GenerateWith("users", GenerateOptions{Single: true})).To(Succeed())
+
+			Expect(generated("users.sql")).To(Equal("-- +turtle Up\n\n\n-- +turtle Down\n\n"))
+		})
+
+		Context("with a built in template", func() {
+			It("renders the create_table template for the dialect", func() {
+				config.DBDriver = "postgres"
+
+				err := GenerateWith("create_users", GenerateOptions{
+					Template: "create_table",
+					Table:    "users",
+					Columns:  []Column{ParseColumn("email:varchar(255)"), ParseColumn("name:text")},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(generated("create_users_up.sql")).To(Equal(
+					"CREATE TABLE users (\n  id SERIAL PRIMARY KEY,\n  email varchar(255),\n  name text\n);\n",
+				))
+				Expect(generated("create_users_down.sql")).To(Equal("DROP TABLE users;\n"))
+			})
+
+			It("renders the add_column template", func() {
+				err := GenerateWith("add_email_to_users", GenerateOptions{
+					Template: "add_column",
+					Table:    "users",
+					Columns:  []Column{ParseColumn("email:varchar(255)")},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(generated("add_email_to_users_up.sql")).To(Equal("ALTER TABLE users ADD COLUMN email varchar(255);\n"))
+				Expect(generated("add_email_to_users_down.sql")).To(Equal("ALTER TABLE users DROP COLUMN email;\n"))
+			})
+
+			It("renders the add_index template into a single file", func() {
+				err := GenerateWith("index_users", GenerateOptions{
+					Single:   true,
+					Template: "add_index",
+					Table:    "users",
+					Columns:  []Column{ParseColumn("last_name"), ParseColumn("first_name")},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(generated("index_users.sql")).To(Equal(
+					"-- +turtle Up\nCREATE INDEX users_last_name_first_name_idx ON users (last_name, first_name);\n\n" +
+						"-- +turtle Down\nDROP INDEX users_last_name_first_name_idx ON users;\n",
+				))
+			})
+
+			It("returns an error without a table", func() {
+				err := GenerateWith("users", GenerateOptions{Template: "create_table"})
+				Expect(err).To(Equal(ErrNoTemplateTable))
+			})
+
+			It("returns an error without a column", func() {
+				err := GenerateWith("users", GenerateOptions{Template: "add_column", Table: "users"})
+				Expect(err).To(Equal(ErrNoTemplateColumns))
+			})
+		})
+
+		Context("with a template in the template directory", func() {
+			BeforeEach(func() {
+				Expect(os.Mkdir(config.TemplatesPath, 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(
+					path.Join(config.TemplatesPath, "add_column_up.sql.tmpl"),
+					[]byte("-- {{.Name}} ({{.Timestamp}}) for {{.Dialect}}\n{{range .Columns}}ALTER TABLE {{$.Table}} ADD {{.Name}} {{.Type}} NOT NULL;{{end}}\n"),
+					0644,
+				)).To(Succeed())
+			})
+
+			It("renders it in place of the built in template", func() {
+				err := GenerateWith("add_email", GenerateOptions{
+					Template: "add_column",
+					Table:    "users",
+					Columns:  []Column{ParseColumn("email:text")},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				up := generated("add_email_up.sql")
+				Expect(up).To(MatchRegexp(`^-- add_email \(\d+\) for mysql\n`))
+				Expect(up).To(HaveSuffix("ALTER TABLE users ADD email text NOT NULL;\n"))
+				Expect(generated("add_email_down.sql")).To(BeEmpty())
+			})
+		})
+
+		It("returns an error for an unknown template", func() {
+			err := GenerateWith("users", GenerateOptions{Template: "create_tables", Table: "users"})
+			Expect(err).To(MatchError(ContainSubstring("unknown template: create_tables")))
+		})
+
+		Context("with the sequential ID scheme", func() {
+			It("numbers the first migration 1, zero padded", func() {
+				Expect(GenerateWith("users", GenerateOptions{IDScheme: config.IDSchemeSequential})).To(Succeed())
+
+				_, err := os.Stat(path.Join(config.MigrationsPath, "0001_users_up.sql"))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("numbers the migration after the highest version, including in subdirectories", func() {
+				Expect(os.MkdirAll(path.Join(config.MigrationsPath, "2015"), 0755)).To(Succeed())
+				for _, name := range []string{"0009_accounts_up.sql", "2015/0010_users.sql", "0002_posts_down.sql"} {
+					Expect(ioutil.WriteFile(path.Join(config.MigrationsPath, name), []byte(""), 0644)).To(Succeed())
+				}
+
+				Expect(GenerateWith("emails", GenerateOptions{IDScheme: config.IDSchemeSequential, Single: true})).To(Succeed())
+
+				_, err := os.Stat(path.Join(config.MigrationsPath, "0011_emails.sql"))
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		It("numbers the migration with the UTC time", func() {
+			Expect(GenerateWith("users", GenerateOptions{IDScheme: config.IDSchemeUTC, Single: true})).To(Succeed())
+
+			matches, err := filepath.Glob(path.Join(config.MigrationsPath, "*_users.sql"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(matches).To(HaveLen(1))
+			Expect(path.Base(matches[0])).To(MatchRegexp(`^\d{17}_users\.sql$`))
+		})
 
+		It("returns an error for an unknown ID scheme", func() {
+			err := GenerateWith("users", GenerateOptions{IDScheme: "uuid"})
+			Expect(err).To(Equal(config.ErrInvalidIDScheme))
+		})
 	})
 })
@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrNotSupported is raised when a file from an io/fs.FS doesn't support an operation of the File interface, such as
+// seeking in a file from a zip archive.
+var ErrNotSupported = errors.New("operation not supported by the file")
+
+// FromFS returns a FileSystem backed by an io/fs.FS, such as an embed.FS, fstest.MapFS or zip.Reader, so that
+// migrations can be embedded into the binary. Names are converted to io/fs paths, so `./migrations` and `migrations/`
+// both refer to `migrations` in fsys.
+func FromFS(fsys fs.FS) FileSystem {
+	return ioFS{fsys: fsys}
+}
+
+// ioFS implements FileSystem by wrapping an io/fs.FS.
+type ioFS struct {
+	fsys fs.FS
+}
+
+func (f ioFS) Open(name string) (File, error) {
+	file, err := f.fsys.Open(fsPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return ioFile{File: file}, nil
+}
+
+func (f ioFS) Stat(name string) (os.FileInfo, error) { return fs.Stat(f.fsys, fsPath(name)) }
+func (f ioFS) ReadFile(name string) ([]byte, error)  { return fs.ReadFile(f.fsys, fsPath(name)) }
+
+// fsPath converts a name to an io/fs path, which is slash separated and unrooted. The root, e.g. `.` or `/`, is `.`.
+func fsPath(name string) string {
+	p := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// ioFile implements File by wrapping an io/fs.File. The optional File methods are used when the wrapped file supports
+// them, otherwise they return ErrNotSupported.
+type ioFile struct {
+	fs.File
+}
+
+func (f ioFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.File.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, ErrNotSupported
+}
+
+func (f ioFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, ErrNotSupported
+}
+
+func (f ioFile) Readdir(n int) ([]os.FileInfo, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	entries, err := dir.ReadDir(n)
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, infoErr := entry.Info()
+		if infoErr != nil {
+			return infos, infoErr
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, err
+}
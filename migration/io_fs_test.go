@@ -0,0 +1,61 @@
+package migration_test
+
+import (
+	"io/fs"
+	"testing/fstest"
+
+	"github.com/nicday/turtle/db"
+	. "github.com/nicday/turtle/migration"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FromFS", func() {
+	fsys := fstest.MapFS{
+		"migrations/20150703234300001_first_up.sql":   {Data: []byte("CREATE TABLE first")},
+		"migrations/20150703234300001_first_down.sql": {Data: []byte("DROP TABLE first")},
+		"migrations/README.md":                        {Data: []byte("Migrations")},
+	}
+
+	It("loads migrations from an io/fs.FS", func() {
+		runner := NewRunner(FromFS(fsys), "./migrations/", db.DefaultLog())
+		runner.GoMigrations = nil
+
+		migrations, err := runner.Migrations()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrations).To(Equal(map[string]*Migration{
+			"20150703234300001_first": {
+				ID:       "20150703234300001_first",
+				UpPath:   "migrations/20150703234300001_first_up.sql",
+				DownPath: "migrations/20150703234300001_first_down.sql",
+			},
+		}))
+	})
+
+	It("loads migrations from the root of a sub tree", func() {
+		sub, err := fs.Sub(fsys, "migrations")
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, root := range []string{".", "", "./", "/"} {
+			runner := NewRunner(FromFS(sub), root, db.DefaultLog())
+			runner.GoMigrations = nil
+
+			migrations, err := runner.Migrations()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(migrations).To(HaveKey("20150703234300001_first"))
+			Expect(migrations["20150703234300001_first"].DownPath).NotTo(BeEmpty())
+		}
+	})
+
+	It("reads files", func() {
+		content, err := FromFS(fsys).ReadFile("/migrations/20150703234300001_first_up.sql")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("CREATE TABLE first"))
+	})
+
+	It("returns an error for a missing directory", func() {
+		_, err := FromFS(fsys).Open("missing")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,206 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// migrationFileRegex matches the whole name of a migration file, where the other patterns only need to match part
+	// of it.
+	migrationFileRegex = regexp.MustCompile(`^\d+_[\w-]+(_up|_down)?\.sql$`)
+
+	// nearMissRegex matches names that look like they were meant to be migration files.
+	nearMissRegex = regexp.MustCompile(`(?i)(^\d|\.sql|_up\b|_down\b)`)
+
+	// directionSuffixRegex matches a direction suffix in any case, a single file migration named with one was probably
+	// meant to be an up or down file.
+	directionSuffixRegex = regexp.MustCompile(`(?i)_(up|down)\.sql$`)
+)
+
+// LintIssue is a problem with a migration file or migration found by Lint.
+type LintIssue struct {
+	// Path is the file with the problem, or empty if the problem is with the migration as a whole.
+	Path string
+
+	// ID is the migration with the problem, it is empty for files that aren't recognised as migrations.
+	ID string
+
+	Message string
+}
+
+// String returns a description of the issue.
+func (i LintIssue) String() string {
+	if i.Path != "" {
+		return fmt.Sprintf("%s: %s", i.Path, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.ID, i.Message)
+}
+
+// LintFiles checks the migration directory and its subdirectories for files that almost match the migration file
+// pattern, migrations that are missing a direction or are empty, and migration versions used by more than one
+// migration. The database isn't queried.
+func (r *Runner) LintFiles() ([]LintIssue, error) {
+	issues, _, err := r.lintFiles()
+	return issues, err
+}
+
+// Lint runs the checks of LintFiles, and also checks for pending migrations that are older than applied migrations,
+// which will be applied out of order. The migrations table isn't created if it's missing.
+func (r *Runner) Lint(ctx context.Context) ([]LintIssue, error) {
+	issues, migrations, err := r.lintFiles()
+	if err != nil {
+		return issues, err
+	}
+
+	present, err := r.Log.TablePresent(ctx)
+	if err != nil || !present {
+		return issues, err
+	}
+
+	records, err := r.Log.Applied(ctx)
+	if err != nil {
+		return issues, err
+	}
+	applied := map[string]bool{}
+	for _, record := range records {
+		applied[record.ID] = true
+	}
+
+	late, latest := outOfOrder(SortMigrations(migrations, "asc"), func(m *Migration) bool { return applied[m.ID] })
+	for _, m := range late {
+		issues = append(issues, LintIssue{
+			ID:      m.ID,
+			Message: fmt.Sprintf("pending but older than the applied migration %s", latest.ID),
+		})
+	}
+
+	return issues, nil
+}
+
+// lintFiles returns the issues with the migration files, along with the migrations.
+func (r *Runner) lintFiles() ([]LintIssue, map[string]*Migration, error) {
+	issues := []LintIssue{}
+
+	files, err := walk(r.FS, r.Path)
+	if err != nil {
+		return issues, nil, err
+	}
+
+	for _, p := range files {
+		name := path.Base(p)
+		switch {
+		// Templates for generate are kept alongside the migrations by default.
+		case path.Ext(name) == ".tmpl":
+		case !migrationFileRegex.MatchString(name) && (valid(name) || nearMissRegex.MatchString(name)):
+			issues = append(issues, LintIssue{
+				Path:    p,
+				Message: "doesn't match <id>_<name>_up.sql, <id>_<name>_down.sql or <id>_<name>.sql",
+			})
+		case single(name) && directionSuffixRegex.MatchString(name):
+			issues = append(issues, LintIssue{
+				Path:    p,
+				Message: "is loaded as a single file migration, the _up and _down suffixes must be lowercase",
+			})
+		}
+	}
+
+	// Duplicate versions are reported as an issue, rather than the error from Migrations.
+	migrations, err := r.loadMigrations()
+	if err != nil {
+		return issues, migrations, err
+	}
+
+	sorted := SortMigrations(migrations, "asc")
+	versions := map[string][]string{}
+	for _, m := range sorted {
+		version := strings.TrimLeft(migrationVersion(m.ID), "0")
+		versions[version] = append(versions[version], m.ID)
+
+		issues = append(issues, r.lintMigration(m)...)
+	}
+
+	for _, m := range sorted {
+		version := migrationVersion(m.ID)
+		if ids := versions[strings.TrimLeft(version, "0")]; len(ids) > 1 && ids[0] == m.ID {
+			issues = append(issues, LintIssue{
+				ID:      m.ID,
+				Message: fmt.Sprintf("version %s is used by more than one migration: %s", version, strings.Join(ids, ", ")),
+			})
+		}
+	}
+
+	return issues, migrations, nil
+}
+
+// lintMigration returns the issues with each direction of the migration.
+func (r *Runner) lintMigration(m *Migration) []LintIssue {
+	issues := []LintIssue{}
+
+	if m.isGo() {
+		if m.Down == nil {
+			issues = append(issues, LintIssue{ID: m.ID, Message: "missing down function"})
+		}
+		return issues
+	}
+
+	for _, direction := range []string{"up", "down"} {
+		p := m.UpPath
+		if direction == "down" {
+			p = m.DownPath
+		}
+		if p == "" {
+			issues = append(issues, LintIssue{ID: m.ID, Message: fmt.Sprintf("missing %s file", direction)})
+			continue
+		}
+
+		query, err := r.source(m, direction)
+		if err != nil {
+			issues = append(issues, LintIssue{Path: p, ID: m.ID, Message: err.(*Error).Err.Error()})
+			// A single file that can't be read or split into sections has the same problem in both directions.
+			if single(p) && direction == "up" {
+				break
+			}
+			continue
+		}
+
+		statements, err := SplitStatements(string(query), r.Log.Dialect.Syntax())
+		if err != nil {
+			issues = append(issues, LintIssue{Path: p, ID: m.ID, Message: err.Error()})
+			continue
+		}
+		if len(statements) == 0 {
+			issues = append(issues, LintIssue{Path: p, ID: m.ID, Message: fmt.Sprintf("%s migration is empty", direction)})
+		}
+	}
+
+	return issues
+}
+
+// Lint prints the issues with the migrations, returning the number found. The applied migrations aren't checked when
+// offline.
+func Lint(w io.Writer, offline bool) (int, error) {
+	r := DefaultRunner()
+
+	var issues []LintIssue
+	var err error
+	if offline {
+		issues, err = r.LintFiles()
+	} else {
+		issues, err = r.Lint(context.Background())
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, issue := range issues {
+		fmt.Fprintln(w, issue)
+	}
+	fmt.Fprintf(w, "%d issue(s) found\n", len(issues))
+
+	return len(issues), nil
+}
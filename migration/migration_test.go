@@ -1,7 +1,12 @@
 package migration_test
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"regexp"
 
@@ -64,30 +69,67 @@ var _ = Describe("migration", func() {
 	})
 
 	Describe("#Apply", func() {
+		Context("when the migration log can't be updated", func() {
+			It("rolls back the transaction and reports the migration as unrecorded", func() {
+				m := Migration{ID: "20150703234300001_first", UpPath: "migrations/20150703234300001_first_up.sql"}
 
+				expectedMigrationActiveQuery(m.ID, false)
+				expectedMigration("CREATE TABLE first")
+				sqlmock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("INSERT INTO `%s`", config.MigrationsTableName))).
+					WillReturnError(errors.New("lost connection"))
+				sqlmock.ExpectRollback()
+
+				err := m.Apply()
+
+				Expect(err).To(HaveOccurred())
+				Expect(err.(*Error).Unrecorded).To(BeTrue())
+			})
+		})
 	})
 
 	Describe("#Revert", func() {
+		Context("when the migration fails", func() {
+			It("rolls back the transaction without updating the migration log", func() {
+				m := Migration{ID: "20150703234300001_first", DownPath: "migrations/20150703234300001_first_down.sql"}
+
+				expectedMigrationActiveQuery(m.ID, true)
+				sqlmock.ExpectBegin()
+				sqlmock.ExpectExec(regexp.QuoteMeta("DROP TABLE first")).
+					WillReturnError(errors.New("unknown table"))
+				sqlmock.ExpectRollback()
 
+				reverted, err := m.Revert()
+
+				Expect(reverted).To(BeFalse())
+				Expect(err).To(MatchError(ContainSubstring("statement 1 (line 1): unknown table")))
+				Expect(err.(*Error).Unrecorded).To(BeFalse())
+			})
+		})
 	})
 
 	Describe(".ApplyAll", func() {
 		Context("with no active migrations", func() {
 			It("applies all migrations", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
+				expectAppliedQuery()
 
 				expectedMigrationActiveQuery("20150703234300001_first", false)
+				expectedMigrationActiveQuery("20150703234300002_second", false)
+				expectedMigrationActiveQuery("20150703234300003_third", false)
+
 				expectedMigration("CREATE TABLE first")
 				expectedMigrationLogInsert("20150703234300001_first")
 
-				expectedMigrationActiveQuery("20150703234300002_second", false)
 				expectedMigration("CREATE TABLE second")
 				expectedMigrationLogInsert("20150703234300002_second")
 
-				expectedMigrationActiveQuery("20150703234300003_third", false)
 				expectedMigration("CREATE TABLE third")
 				expectedMigrationLogInsert("20150703234300003_third")
 
+				expectUnlock()
+
 				err := ApplyAll()
 
 				Expect(err).NotTo(HaveOccurred())
@@ -96,18 +138,23 @@ var _ = Describe("migration", func() {
 
 		Context("with some active migrations", func() {
 			It("applies all inactive migrations", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
+				expectAppliedQuery()
 
 				expectedMigrationActiveQuery("20150703234300001_first", true)
-
 				expectedMigrationActiveQuery("20150703234300002_second", false)
+				expectedMigrationActiveQuery("20150703234300003_third", false)
+
 				expectedMigration("CREATE TABLE second")
 				expectedMigrationLogInsert("20150703234300002_second")
 
-				expectedMigrationActiveQuery("20150703234300003_third", false)
 				expectedMigration("CREATE TABLE third")
 				expectedMigrationLogInsert("20150703234300003_third")
 
+				expectUnlock()
+
 				err := ApplyAll()
 
 				Expect(err).NotTo(HaveOccurred())
@@ -116,26 +163,52 @@ var _ = Describe("migration", func() {
 
 		Context("with all active migrations", func() {
 			It("doesn't apply any migrations", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
+				expectAppliedQuery()
 
 				expectedMigrationActiveQuery("20150703234300001_first", true)
-
 				expectedMigrationActiveQuery("20150703234300002_second", true)
-
 				expectedMigrationActiveQuery("20150703234300003_third", true)
 
+				expectUnlock()
+
 				err := ApplyAll()
 
 				Expect(err).NotTo(HaveOccurred())
 			})
 		})
 
+		Context("when an applied migration has changed", func() {
+			It("doesn't apply any migrations", func() {
+				expectLock()
+				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
+				expectAppliedQuery(db.Record{ID: "20150703234300001_first", Checksum: "edited"})
+
+				expectUnlock()
+
+				err := ApplyAll()
+
+				Expect(err).To(BeAssignableToTypeOf(&ChecksumError{}))
+				Expect(err.(*ChecksumError).Mismatches).To(Equal([]Mismatch{{
+					ID:       "20150703234300001_first",
+					Recorded: "edited",
+					Current:  checksum("CREATE TABLE first"),
+				}}))
+			})
+		})
 	})
 
 	Describe(".Rollback(n)", func() {
 		Context("when n is 0", func() {
 			It("doesn't rollback any migrations", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
+
+				expectUnlock()
 
 				err := Rollback(0)
 
@@ -146,12 +219,16 @@ var _ = Describe("migration", func() {
 
 		Context("when n is 1", func() {
 			It("rolls back a single migration", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
 
 				expectedMigrationActiveQuery("20150703234300003_third", true)
 				expectedMigration("DROP TABLE third")
 				expectedMigrationLogDelete("20150703234300003_third")
 
+				expectUnlock()
+
 				err := Rollback(1)
 
 				Expect(err).NotTo(HaveOccurred())
@@ -160,7 +237,9 @@ var _ = Describe("migration", func() {
 
 		Context("when n is 2", func() {
 			It("rolls back two migrations", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
 
 				expectedMigrationActiveQuery("20150703234300003_third", true)
 				expectedMigration("DROP TABLE third")
@@ -170,6 +249,8 @@ var _ = Describe("migration", func() {
 				expectedMigration("DROP TABLE second")
 				expectedMigrationLogDelete("20150703234300002_second")
 
+				expectUnlock()
+
 				err := Rollback(2)
 
 				Expect(err).NotTo(HaveOccurred())
@@ -178,7 +259,9 @@ var _ = Describe("migration", func() {
 
 		Context("when n is greater than the applied migrations", func() {
 			It("rolls back all migrations", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
 
 				expectedMigrationActiveQuery("20150703234300003_third", true)
 				expectedMigration("DROP TABLE third")
@@ -192,6 +275,8 @@ var _ = Describe("migration", func() {
 				expectedMigration("DROP TABLE first")
 				expectedMigrationLogDelete("20150703234300001_first")
 
+				expectUnlock()
+
 				err := Rollback(4)
 
 				Expect(err).NotTo(HaveOccurred())
@@ -199,10 +284,77 @@ var _ = Describe("migration", func() {
 		})
 	})
 
+	Describe(".MigrateTo", func() {
+		Context("with a target newer than the active migrations", func() {
+			It("applies pending migrations up to and including the target", func() {
+				expectLock()
+				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
+				expectAppliedQuery()
+
+				expectedMigrationActiveQuery("20150703234300003_third", false)
+
+				expectedMigrationActiveQuery("20150703234300001_first", true)
+
+				expectedMigrationActiveQuery("20150703234300002_second", false)
+				expectedMigration("CREATE TABLE second")
+				expectedMigrationLogInsert("20150703234300002_second")
+
+				expectUnlock()
+
+				err := MigrateTo("20150703234300002_second")
+
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("with a target older than the active migrations", func() {
+			It("reverts the migrations newer than the target", func() {
+				expectLock()
+				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
+				expectAppliedQuery()
+
+				expectedMigrationActiveQuery("20150703234300003_third", true)
+				expectedMigration("DROP TABLE third")
+				expectedMigrationLogDelete("20150703234300003_third")
+
+				expectedMigrationActiveQuery("20150703234300002_second", true)
+				expectedMigration("DROP TABLE second")
+				expectedMigrationLogDelete("20150703234300002_second")
+
+				expectedMigrationActiveQuery("20150703234300001_first", true)
+
+				expectUnlock()
+
+				err := MigrateTo("20150703234300001")
+
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("with an unknown target", func() {
+			It("returns an error", func() {
+				expectLock()
+				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
+				expectAppliedQuery()
+
+				expectUnlock()
+
+				err := MigrateTo("20150703234300009")
+
+				Expect(err).To(MatchError(ContainSubstring(ErrUnknownMigration.Error())))
+			})
+		})
+	})
+
 	Describe(".RevertAll", func() {
 		Context("with all active migrations", func() {
 			It("reverts all migrations", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
 
 				expectedMigrationActiveQuery("20150703234300003_third", true)
 				expectedMigration("DROP TABLE third")
@@ -216,6 +368,8 @@ var _ = Describe("migration", func() {
 				expectedMigration("DROP TABLE first")
 				expectedMigrationLogDelete("20150703234300001_first")
 
+				expectUnlock()
+
 				err := RevertAll()
 
 				Expect(err).NotTo(HaveOccurred())
@@ -224,7 +378,9 @@ var _ = Describe("migration", func() {
 
 		Context("with some active migrations", func() {
 			It("reverts all active migrations", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
 
 				expectedMigrationActiveQuery("20150703234300003_third", false)
 
@@ -234,6 +390,8 @@ var _ = Describe("migration", func() {
 				expectedMigration("DROP TABLE first")
 				expectedMigrationLogDelete("20150703234300001_first")
 
+				expectUnlock()
+
 				err := RevertAll()
 
 				Expect(err).NotTo(HaveOccurred())
@@ -242,7 +400,9 @@ var _ = Describe("migration", func() {
 
 		Context("with all migrations inactive", func() {
 			It("doesn't revert any migrations", func() {
+				expectLock()
 				expectMigrationsTablePresenceQuery()
+				expectMigrationsTableColumnsQuery()
 
 				expectedMigrationActiveQuery("20150703234300003_third", false)
 
@@ -250,6 +410,8 @@ var _ = Describe("migration", func() {
 
 				expectedMigrationActiveQuery("20150703234300001_first", false)
 
+				expectUnlock()
+
 				err := RevertAll()
 
 				Expect(err).NotTo(HaveOccurred())
@@ -258,37 +420,40 @@ var _ = Describe("migration", func() {
 	})
 })
 
+// expectedMigration expects the migration SQL in a transaction, which is committed after the migration log update.
 func expectedMigration(sql string) {
 	// Migration transaction
 	sqlmock.ExpectBegin()
 	sqlmock.ExpectExec(regexp.QuoteMeta(sql)).
 		WillReturnResult(sqlmock.NewResult(0, 0))
-	sqlmock.ExpectCommit()
 }
 
 func expectedMigrationLogInsert(id string) {
 	expectedSQL := fmt.Sprintf(
-		"INSERT INTO %s (migration_id) VALUES (?)",
+		"INSERT INTO `%s` (migration_id, applied_at, checksum, duration_ms, turtle_version, applied_by) "+
+			"VALUES (?, ?, ?, ?, ?, ?)",
 		config.MigrationsTableName,
 	)
 	sqlmock.ExpectExec(regexp.QuoteMeta(expectedSQL)).
-		WithArgs(id).
+		WithArgs(id, anyArg{}, anyArg{}, anyArg{}, config.Version, anyArg{}).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlmock.ExpectCommit()
 }
 
 func expectedMigrationLogDelete(id string) {
 	expectedSQL := fmt.Sprintf(
-		"DELETE FROM %s WHERE migration_id=?",
+		"DELETE FROM `%s` WHERE migration_id=?",
 		config.MigrationsTableName,
 	)
 	sqlmock.ExpectExec(regexp.QuoteMeta(expectedSQL)).
 		WithArgs(id).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlmock.ExpectCommit()
 }
 
 func expectedMigrationActiveQuery(id string, active bool) {
 	expectedSQL := fmt.Sprintf(
-		"SELECT id FROM %s WHERE migration_id=?",
+		"SELECT id FROM `%s` WHERE migration_id=?",
 		config.MigrationsTableName,
 	)
 	query := sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
@@ -301,11 +466,86 @@ func expectedMigrationActiveQuery(id string, active bool) {
 	}
 }
 
-func expectMigrationsTablePresenceQuery() {
+func expectLock() {
 	expectedSQL := fmt.Sprintf(
-		"SELECT 1 FROM %s LIMIT 1",
+		"SELECT GET_LOCK(CONCAT(DATABASE(), '.', 'turtle.%s'), 0)",
+		config.MigrationsTableName,
+	)
+	sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+		WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(1))
+}
+
+func expectUnlock() {
+	expectedSQL := fmt.Sprintf(
+		"SELECT RELEASE_LOCK(CONCAT(DATABASE(), '.', 'turtle.%s'))",
 		config.MigrationsTableName,
 	)
 	sqlmock.ExpectExec(regexp.QuoteMeta(expectedSQL)).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 }
+
+func expectMigrationsTablePresenceQuery() {
+	expectedSQL := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+		WithArgs(config.MigrationsTableName).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+}
+
+// expectMigrationsTableColumnsQuery expects the query for the columns of the migrations table, which has every column.
+func expectMigrationsTableColumnsQuery() {
+	expectedSQL := fmt.Sprintf("SELECT * FROM `%s` WHERE 1=0", config.MigrationsTableName)
+	sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id",
+			"migration_id",
+			"applied_at",
+			"checksum",
+			"duration_ms",
+			"turtle_version",
+			"applied_by",
+		}))
+}
+
+// expectAppliedQuery expects the query for the applied migrations, returning the records.
+func expectAppliedQuery(records ...db.Record) {
+	expectMigrationsTableColumnsQuery()
+	expectedSQL := fmt.Sprintf(
+		"SELECT migration_id, applied_at, checksum, duration_ms, turtle_version, applied_by FROM `%s` ORDER BY id",
+		config.MigrationsTableName,
+	)
+	rows := sqlmock.NewRows([]string{
+		"migration_id", "applied_at", "checksum", "duration_ms", "turtle_version", "applied_by",
+	})
+	for _, r := range records {
+		rows.AddRow(r.ID, nil, r.Checksum, nil, nil, nil)
+	}
+	sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+		WillReturnRows(rows)
+}
+
+// checksum returns the hex encoded SHA-256 checksum of a migration.
+func checksum(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// anyArg matches any query argument, for values such as timestamps that can't be predicted.
+type anyArg struct{}
+
+// Match satisfies the sqlmock.Argument interface.
+func (anyArg) Match(driver.Value) bool {
+	return true
+}
+
+var _ = Describe("Register", func() {
+	It("panics with an invalid ID", func() {
+		up := func(ctx context.Context, tx *sql.Tx) error { return nil }
+
+		Expect(func() { Register("backfill", up, nil) }).To(Panic())
+		Expect(func() { Register("20150703234300004_backfill_up.sql", up, nil) }).To(Panic())
+	})
+
+	It("panics without an up function", func() {
+		Expect(func() { Register("20150703234300004_backfill", nil, nil) }).To(Panic())
+	})
+})
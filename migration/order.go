@@ -0,0 +1,72 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nicday/turtle/config"
+)
+
+// ErrOutOfOrder is raised when pending migrations are older than the latest applied migration and the out of order
+// policy is config.OutOfOrderFail.
+var ErrOutOfOrder = errors.New("pending migrations are older than the latest applied migration")
+
+// outOfOrder returns the migrations that aren't applied but sort before the latest applied migration, along with the
+// latest applied migration. The migrations must be in ascending order.
+func outOfOrder(sorted []*Migration, applied func(*Migration) bool) ([]*Migration, *Migration) {
+	latest := -1
+	for i, m := range sorted {
+		if applied(m) {
+			latest = i
+		}
+	}
+	if latest < 0 {
+		return []*Migration{}, nil
+	}
+
+	return filterMigrations(sorted[:latest], -1, func(m *Migration) bool { return !applied(m) }), sorted[latest]
+}
+
+// checkOrder applies the runner's out of order policy to the pending migrations of the sorted migrations. The IDs of
+// the out of order migrations are returned with config.OutOfOrderWarn, so their results can be flagged, and an error
+// is returned with config.OutOfOrderFail.
+func (r *Runner) checkOrder(sorted []*Migration, pending []*Migration) (map[string]bool, error) {
+	late := map[string]bool{}
+	if r.OutOfOrder == config.OutOfOrderAllow {
+		return late, nil
+	}
+
+	isPending := map[string]bool{}
+	for _, m := range pending {
+		isPending[m.ID] = true
+	}
+
+	migrations, latest := outOfOrder(sorted, func(m *Migration) bool { return !isPending[m.ID] })
+	if len(migrations) == 0 {
+		return late, nil
+	}
+
+	ids := []string{}
+	for _, m := range migrations {
+		late[m.ID] = true
+		ids = append(ids, m.ID)
+	}
+
+	if r.OutOfOrder == config.OutOfOrderWarn {
+		return late, nil
+	}
+
+	return late, fmt.Errorf(
+		"%v: %s (latest applied %s); set OUT_OF_ORDER=warn or allow to apply them",
+		ErrOutOfOrder, strings.Join(ids, ", "), latest.ID,
+	)
+}
+
+// flagOutOfOrder marks the results of the out of order migrations.
+func flagOutOfOrder(results []Result, late map[string]bool) []Result {
+	for i := range results {
+		results[i].OutOfOrder = late[results[i].ID]
+	}
+	return results
+}
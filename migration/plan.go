@@ -0,0 +1,230 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Step is a migration that a run would apply or revert, with the SQL it would execute.
+type Step struct {
+	ID        string
+	Direction string
+	Path      string
+	SQL       string
+
+	// Go is true for Go migrations, which have no path or SQL.
+	Go bool
+}
+
+// PlanApplyAll returns the migrations ApplyAll would apply, in order, without changing the database. The migrations
+// table isn't created if it's missing.
+func (r *Runner) PlanApplyAll(ctx context.Context) ([]Step, error) {
+	migrations, applied, err := r.planState(ctx, true)
+	if err != nil {
+		return []Step{}, err
+	}
+
+	sorted := SortMigrations(migrations, "asc")
+	pending := pendingMigrations(sorted, applied)
+	_, err = r.checkOrder(sorted, pending)
+	if err != nil {
+		return []Step{}, err
+	}
+
+	return r.steps(pending, "up")
+}
+
+// PlanRevertAll returns the migrations RevertAll would revert, in order, without changing the database.
+func (r *Runner) PlanRevertAll(ctx context.Context) ([]Step, error) {
+	return r.planRevert(ctx, -1)
+}
+
+// PlanRollback returns the migrations Rollback would revert, in order, without changing the database.
+func (r *Runner) PlanRollback(ctx context.Context, n int) ([]Step, error) {
+	if n < 0 {
+		n = 0
+	}
+	return r.planRevert(ctx, n)
+}
+
+// planRevert plans reverting up to `limit` active migrations, a negative limit plans reverting all of them.
+func (r *Runner) planRevert(ctx context.Context, limit int) ([]Step, error) {
+	migrations, applied, err := r.planState(ctx, false)
+	if err != nil {
+		return []Step{}, err
+	}
+
+	return r.steps(appliedMigrations(SortMigrations(migrations, "desc"), applied, limit), "down")
+}
+
+// PlanMigrateTo returns the migrations MigrateTo would revert and apply, in order, without changing the database.
+func (r *Runner) PlanMigrateTo(ctx context.Context, target string) ([]Step, error) {
+	migrations, applied, err := r.planState(ctx, true)
+	if err != nil {
+		return []Step{}, err
+	}
+
+	id, err := resolveTarget(migrations, target)
+	if err != nil {
+		return []Step{}, err
+	}
+
+	newer := []*Migration{}
+	for _, m := range SortMigrations(migrations, "desc") {
+		if m.ID == id {
+			break
+		}
+		newer = append(newer, m)
+	}
+
+	older := []*Migration{}
+	for _, m := range SortMigrations(migrations, "asc") {
+		older = append(older, m)
+		if m.ID == id {
+			break
+		}
+	}
+
+	down, err := r.steps(appliedMigrations(newer, applied, -1), "down")
+	if err != nil {
+		return down, err
+	}
+	pending := pendingMigrations(older, applied)
+	_, err = r.checkOrder(older, pending)
+	if err != nil {
+		return down, err
+	}
+	up, err := r.steps(pending, "up")
+
+	return append(down, up...), err
+}
+
+// planState returns the migrations in the migration directory and the IDs of the applied migrations, optionally
+// validating the checksums of the applied migrations as an up run would.
+func (r *Runner) planState(ctx context.Context, validate bool) (map[string]*Migration, map[string]bool, error) {
+	applied := map[string]bool{}
+
+	migrations, err := r.Migrations()
+	if err != nil {
+		return migrations, applied, err
+	}
+
+	present, err := r.Log.TablePresent(ctx)
+	if err != nil || !present {
+		return migrations, applied, err
+	}
+
+	if validate {
+		err := r.validate(ctx)
+		if err != nil {
+			return migrations, applied, err
+		}
+	}
+
+	records, err := r.Log.Applied(ctx)
+	if err != nil {
+		return migrations, applied, err
+	}
+	for _, record := range records {
+		applied[record.ID] = true
+	}
+
+	return migrations, applied, nil
+}
+
+// steps reads the SQL for each migration in the direction.
+func (r *Runner) steps(migrations []*Migration, direction string) ([]Step, error) {
+	steps := []Step{}
+
+	for _, m := range migrations {
+		query, err := r.source(m, direction)
+		if err != nil {
+			return steps, err
+		}
+
+		p := m.UpPath
+		if direction == "down" {
+			p = m.DownPath
+		}
+
+		steps = append(steps, Step{ID: m.ID, Direction: direction, Path: p, SQL: string(query), Go: m.isGo()})
+	}
+
+	return steps, nil
+}
+
+// pendingMigrations returns the migrations that haven't been applied.
+func pendingMigrations(migrations []*Migration, applied map[string]bool) []*Migration {
+	return filterMigrations(migrations, -1, func(m *Migration) bool { return !applied[m.ID] })
+}
+
+// appliedMigrations returns up to `limit` of the migrations that have been applied, a negative limit returns all of them.
+func appliedMigrations(migrations []*Migration, applied map[string]bool, limit int) []*Migration {
+	return filterMigrations(migrations, limit, func(m *Migration) bool { return applied[m.ID] })
+}
+
+// filterMigrations returns up to `limit` of the migrations that keep returns true for, a negative limit returns all of
+// them.
+func filterMigrations(migrations []*Migration, limit int, keep func(*Migration) bool) []*Migration {
+	kept := []*Migration{}
+	for _, m := range migrations {
+		if limit >= 0 && len(kept) >= limit {
+			break
+		}
+		if keep(m) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// PrintPlan prints each step with its SQL, in the order they would run.
+func PrintPlan(w io.Writer, steps []Step) {
+	if len(steps) == 0 {
+		fmt.Fprintln(w, "-- No migrations to run")
+		return
+	}
+
+	for _, s := range steps {
+		if s.Go {
+			fmt.Fprintf(w, "-- Migration (%s) %s: Go function\n\n", s.ID, s.Direction)
+			continue
+		}
+		fmt.Fprintf(w, "-- Migration (%s) %s: %s\n%s\n\n", s.ID, s.Direction, s.Path, strings.TrimSpace(s.SQL))
+	}
+}
+
+// DryRunApplyAll prints the migrations ApplyAll would apply, without changing the database.
+func DryRunApplyAll() error {
+	return dryRun(DefaultRunner().PlanApplyAll(context.Background()))
+}
+
+// DryRunRevertAll prints the migrations RevertAll would revert, without changing the database.
+func DryRunRevertAll() error {
+	return dryRun(DefaultRunner().PlanRevertAll(context.Background()))
+}
+
+// DryRunRollback prints the migrations Rollback would revert, without changing the database.
+func DryRunRollback(n int) error {
+	return dryRun(DefaultRunner().PlanRollback(context.Background(), n))
+}
+
+// DryRunMigrateTo prints the migrations MigrateTo would revert and apply, without changing the database.
+func DryRunMigrateTo(target string) error {
+	return dryRun(DefaultRunner().PlanMigrateTo(context.Background(), target))
+}
+
+// dryRun prints the planned steps, or logs the error that would stop the run.
+func dryRun(steps []Step, err error) error {
+	if err != nil {
+		log.Printf("[Error] %v", err)
+		return err
+	}
+
+	PrintPlan(os.Stdout, steps)
+	return nil
+}
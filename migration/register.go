@@ -0,0 +1,64 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// goMigrationIDRegex matches the ID of a Go migration, which follows the file naming without the direction suffix.
+var goMigrationIDRegex = regexp.MustCompile(`^\d+_[\w-]+$`)
+
+// GoFunc is the up or down function of a migration written in Go. It runs in the migration's transaction, which is
+// committed along with the migration log update when it returns nil.
+type GoFunc func(ctx context.Context, tx *sql.Tx) error
+
+// registered are the Go migrations added with Register, keyed by ID.
+var registered = map[string]*Migration{}
+
+// registeredSets are the Go migrations added with RegisterSet, keyed by set name and ID.
+var registeredSets = map[string]map[string]*Migration{}
+
+// Register adds a migration written in Go, e.g. for a data backfill that needs application logic. The ID follows the
+// file naming, `<version>_<name>`, so that SortMigrations orders it with the file migrations, and it's recorded in the
+// same migrations table. Down may be nil if the migration can't be reverted. Register is intended to be called from
+// init functions, it panics if the ID is invalid, up is nil or the ID is registered twice.
+func Register(id string, up, down GoFunc) {
+	register(registered, id, up, down)
+}
+
+// RegisterSet adds a migration written in Go to the named migration set, as Register does for runs without migration
+// sets. Each set only runs its own Go migrations, which are recorded in the set's migrations table.
+func RegisterSet(set, id string, up, down GoFunc) {
+	if registeredSets[set] == nil {
+		registeredSets[set] = map[string]*Migration{}
+	}
+	register(registeredSets[set], id, up, down)
+}
+
+// register adds the Go migration to migrations, panicking if it's invalid or already registered.
+func register(migrations map[string]*Migration, id string, up, down GoFunc) {
+	if !goMigrationIDRegex.MatchString(id) {
+		panic(fmt.Sprintf("migration: invalid Go migration ID %s, expected <version>_<name>", id))
+	}
+	if up == nil {
+		panic(fmt.Sprintf("migration: Go migration %s has no up function", id))
+	}
+	if _, ok := migrations[id]; ok {
+		panic(fmt.Sprintf("migration: Go migration %s registered twice", id))
+	}
+
+	migrations[id] = &Migration{ID: id, Up: up, Down: down}
+}
+
+// goMigrations returns the Go migrations of the named migration set, or those added with Register when set is empty.
+func goMigrations(set string) map[string]*Migration {
+	if set == "" {
+		return registered
+	}
+	if migrations, ok := registeredSets[set]; ok {
+		return migrations
+	}
+	return map[string]*Migration{}
+}
@@ -0,0 +1,826 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"time"
+
+	"github.com/nicday/turtle/config"
+	"github.com/nicday/turtle/db"
+)
+
+// Runner applies and reverts the migrations in a directory of a FileSystem, recording them in a migration log. A
+// Runner doesn't use any package state, so several can be used at once.
+type Runner struct {
+	FS   FileSystem
+	Path string
+	Log  *db.Log
+
+	// LockTimeout is how long to wait for another process to release the migration lock.
+	LockTimeout time.Duration
+
+	// TransactionMode is how migrations are grouped into transactions, either config.TransactionPerMigration or
+	// config.TransactionAll.
+	TransactionMode string
+
+	// OutOfOrder is the policy for pending migrations older than the latest applied migration, either
+	// config.OutOfOrderFail, config.OutOfOrderWarn or config.OutOfOrderAllow.
+	OutOfOrder string
+
+	// GoMigrations are the migrations written in Go, keyed by ID, that are run along with the migration files.
+	// Defaults to the migrations added with Register.
+	GoMigrations map[string]*Migration
+}
+
+var (
+	// ErrUnknownMigration is raised when a target migration isn't in the migration directory.
+	ErrUnknownMigration = errors.New("migration not found")
+
+	// ErrDuplicateMigration is raised when two migrations share an ID.
+	ErrDuplicateMigration = errors.New("duplicate migration ID")
+
+	// ErrDuplicateVersion is raised when two migrations share a numeric version, e.g. 0002_users and 2_accounts, so
+	// their order would be ambiguous.
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+
+	// ErrIrreversible is raised when reverting a migration without a down file, section or function.
+	ErrIrreversible = errors.New("migration has no down migration")
+
+	// ErrEmptyMigration is raised when running a migration file or section that has no statements, such as a generated
+	// migration that hasn't been filled in.
+	ErrEmptyMigration = errors.New("migration has no statements")
+
+	// ErrNoTransactionInBatch is raised when a migration with the `-- turtle:no-transaction` directive would be applied
+	// with all the pending migrations in a single transaction.
+	ErrNoTransactionInBatch = errors.New("turtle:no-transaction can't be used when all migrations run in one transaction")
+)
+
+// NewRunner initializes a new Runner for the migrations in path.
+func NewRunner(fs FileSystem, path string, log *db.Log) *Runner {
+	return &Runner{
+		FS:              fs,
+		Path:            path,
+		Log:             log,
+		LockTimeout:     config.LockTimeout,
+		TransactionMode: config.TransactionMode,
+		OutOfOrder:      config.OutOfOrder,
+		GoMigrations:    registered,
+	}
+}
+
+// DefaultRunner returns a Runner for the active FileSystem, the configured migrations path and the default log. When a
+// migration set is selected, it runs the Go migrations of the set.
+func DefaultRunner() *Runner {
+	r := NewRunner(FS, config.MigrationsPath, db.DefaultLog())
+	r.GoMigrations = goMigrations(config.CurrentMigrationSet)
+	return r
+}
+
+// Result is a migration that was applied or reverted.
+type Result struct {
+	ID        string
+	Direction string
+
+	// OutOfOrder is true if the migration was applied after a newer migration, see config.OutOfOrderWarn.
+	OutOfOrder bool
+
+	// Set is the migration set of the migration, when the migrations of several sets are run together by Sets.
+	Set string
+}
+
+// String returns a description of the result.
+func (r Result) String() string {
+	id := r.ID
+	if r.Set != "" {
+		id = r.Set + "/" + r.ID
+	}
+
+	if r.Direction == "down" {
+		return fmt.Sprintf("Migration (%s) reverted", id)
+	}
+	if r.OutOfOrder {
+		return fmt.Sprintf("Migration (%s) applied out of order", id)
+	}
+	return fmt.Sprintf("Migration (%s) applied", id)
+}
+
+// Error is returned when a migration can't be applied or reverted.
+type Error struct {
+	ID        string
+	Direction string
+	Err       error
+
+	// Unrecorded is true when the migration's changes may have been committed without the migration log being updated
+	// to match. This can happen with dialects without transactional DDL, such as MySQL, where DDL statements commit
+	// implicitly.
+	Unrecorded bool
+}
+
+// Error satisfies the error interface.
+func (e *Error) Error() string {
+	action := "apply"
+	if e.Direction == "down" {
+		action = "revert"
+	}
+	msg := fmt.Sprintf("unable to %s migration (%s): %v", action, e.ID, e.Err)
+	if e.Unrecorded {
+		msg += "; the migration may have been committed without updating the migration log, check the database " +
+			"before retrying"
+	}
+	return msg
+}
+
+// Apply runs the up migration on the database. True will be returned if the migration was applied, false if it was
+// already active.
+func (r *Runner) Apply(ctx context.Context, m *Migration) (bool, error) {
+	active, err := r.Log.Active(ctx, m.ID)
+	if err != nil {
+		return false, err
+	}
+	if active {
+		return false, nil
+	}
+
+	query, err := r.source(m, "up")
+	if err != nil {
+		return false, err
+	}
+
+	err = r.apply(ctx, m, query)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// apply runs the up migration, without checking if it's already active.
+func (r *Runner) apply(ctx context.Context, m *Migration, query []byte) error {
+	record := func(e db.Execer, duration time.Duration) error {
+		return r.Log.InsertWith(ctx, e, r.record(m, query, duration))
+	}
+
+	if m.isGo() {
+		return r.execGo(ctx, m.ID, "up", m.Up, record)
+	}
+	return r.exec(ctx, m.ID, "up", string(query), record)
+}
+
+// record returns the migration log record for an applied migration. Go migrations don't have a checksum.
+func (r *Runner) record(m *Migration, query []byte, duration time.Duration) db.Record {
+	sum := ""
+	if !m.isGo() {
+		sum = upChecksum(m.UpPath, query)
+	}
+
+	return db.Record{
+		ID:        m.ID,
+		Checksum:  sum,
+		Duration:  duration,
+		Version:   config.Version,
+		AppliedBy: appliedBy(),
+	}
+}
+
+// source returns the SQL of the migration in the direction, which is nil for Go migrations.
+func (r *Runner) source(m *Migration, direction string) ([]byte, error) {
+	if m.isGo() {
+		if direction == "down" && m.Down == nil {
+			return nil, &Error{ID: m.ID, Direction: direction, Err: ErrIrreversible}
+		}
+		return nil, nil
+	}
+
+	p := m.UpPath
+	if direction == "down" {
+		p = m.DownPath
+		if p == "" {
+			return nil, &Error{ID: m.ID, Direction: direction, Err: ErrIrreversible}
+		}
+	}
+
+	query, err := r.FS.ReadFile(p)
+	if err != nil {
+		return nil, &Error{ID: m.ID, Direction: direction, Err: err}
+	}
+
+	if single(p) {
+		query, err = section(query, direction)
+		if err != nil {
+			return nil, &Error{ID: m.ID, Direction: direction, Err: err}
+		}
+	}
+
+	return query, nil
+}
+
+// Revert runs the down migration on the database. True will be returned if the migration was reverted, false if it
+// wasn't active.
+func (r *Runner) Revert(ctx context.Context, m *Migration) (bool, error) {
+	active, err := r.Log.Active(ctx, m.ID)
+	if err != nil {
+		return false, err
+	}
+	if !active {
+		return false, nil
+	}
+
+	query, err := r.source(m, "down")
+	if err != nil {
+		return false, err
+	}
+
+	record := func(e db.Execer, _ time.Duration) error {
+		return r.Log.DeleteWith(ctx, e, m.ID)
+	}
+
+	if m.isGo() {
+		err = r.execGo(ctx, m.ID, "down", m.Down, record)
+	} else {
+		err = r.exec(ctx, m.ID, "down", string(query), record)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ApplyAll applies all migrations in chronological order. The applied migrations are returned, including when an
+// error stops the run part way through. Nothing is applied if an applied migration has changed since it was applied,
+// see Validate.
+func (r *Runner) ApplyAll(ctx context.Context) ([]Result, error) {
+	return r.locked(ctx, r.applyAll)
+}
+
+func (r *Runner) applyAll(ctx context.Context) ([]Result, error) {
+	results := []Result{}
+
+	err := r.assertTable(ctx)
+	if err != nil {
+		return results, err
+	}
+
+	err = r.validate(ctx)
+	if err != nil {
+		return results, err
+	}
+
+	migrations, err := r.Migrations()
+	if err != nil {
+		return results, err
+	}
+
+	sorted := SortMigrations(migrations, "asc")
+	pending, err := r.pending(ctx, sorted)
+	if err != nil {
+		return results, err
+	}
+
+	late, err := r.checkOrder(sorted, pending)
+	if err != nil {
+		return results, err
+	}
+
+	results, err = r.applyPending(ctx, pending)
+	return flagOutOfOrder(results, late), err
+}
+
+// RevertAll reverts all migrations in reverse chronological order. The reverted migrations are returned, including
+// when an error stops the run part way through.
+func (r *Runner) RevertAll(ctx context.Context) ([]Result, error) {
+	return r.locked(ctx, func(ctx context.Context) ([]Result, error) {
+		return r.revert(ctx, -1)
+	})
+}
+
+// Rollback reverts the latest `n` active migrations. The reverted migrations are returned, including when an error
+// stops the run part way through.
+func (r *Runner) Rollback(ctx context.Context, n int) ([]Result, error) {
+	if n < 0 {
+		n = 0
+	}
+	return r.locked(ctx, func(ctx context.Context) ([]Result, error) {
+		return r.revert(ctx, n)
+	})
+}
+
+// revert reverts up to `limit` active migrations in reverse chronological order, a negative limit reverts all of them.
+func (r *Runner) revert(ctx context.Context, limit int) ([]Result, error) {
+	results := []Result{}
+
+	err := r.assertTable(ctx)
+	if err != nil {
+		return results, err
+	}
+
+	migrations, err := r.Migrations()
+	if err != nil {
+		return results, err
+	}
+
+	for _, m := range SortMigrations(migrations, "desc") {
+		// If the count of performed migrations has reached the limit, we're done.
+		if limit >= 0 && len(results) >= limit {
+			break
+		}
+		reverted, err := r.Revert(ctx, m)
+		if err != nil {
+			return results, err
+		}
+		if reverted {
+			results = append(results, Result{ID: m.ID, Direction: "down"})
+		}
+	}
+
+	return results, nil
+}
+
+// MigrateTo applies pending migrations up to and including the target migration, and reverts active migrations newer
+// than it. The target is either a migration ID or its numeric version. The performed migrations are returned, including
+// when an error stops the run part way through. Like ApplyAll, nothing is performed if an applied migration has changed.
+func (r *Runner) MigrateTo(ctx context.Context, target string) ([]Result, error) {
+	return r.locked(ctx, func(ctx context.Context) ([]Result, error) {
+		return r.migrateTo(ctx, target)
+	})
+}
+
+func (r *Runner) migrateTo(ctx context.Context, target string) ([]Result, error) {
+	results := []Result{}
+
+	err := r.assertTable(ctx)
+	if err != nil {
+		return results, err
+	}
+
+	err = r.validate(ctx)
+	if err != nil {
+		return results, err
+	}
+
+	migrations, err := r.Migrations()
+	if err != nil {
+		return results, err
+	}
+
+	id, err := resolveTarget(migrations, target)
+	if err != nil {
+		return results, err
+	}
+
+	// Revert the active migrations newer than the target first, newest to oldest.
+	for _, m := range SortMigrations(migrations, "desc") {
+		if m.ID == id {
+			break
+		}
+		reverted, err := r.Revert(ctx, m)
+		if err != nil {
+			return results, err
+		}
+		if reverted {
+			results = append(results, Result{ID: m.ID, Direction: "down"})
+		}
+	}
+
+	// Then apply the pending migrations up to and including the target.
+	older := []*Migration{}
+	for _, m := range SortMigrations(migrations, "asc") {
+		older = append(older, m)
+		if m.ID == id {
+			break
+		}
+	}
+
+	pending, err := r.pending(ctx, older)
+	if err != nil {
+		return results, err
+	}
+
+	late, err := r.checkOrder(older, pending)
+	if err != nil {
+		return results, err
+	}
+
+	applied, err := r.applyPending(ctx, pending)
+	return append(results, flagOutOfOrder(applied, late)...), err
+}
+
+// pending returns the migrations that aren't active, keeping their order.
+func (r *Runner) pending(ctx context.Context, migrations []*Migration) ([]*Migration, error) {
+	pending := []*Migration{}
+
+	for _, m := range migrations {
+		active, err := r.Log.Active(ctx, m.ID)
+		if err != nil {
+			return pending, err
+		}
+		if !active {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending, nil
+}
+
+// applyPending applies the pending migrations in order, each in its own transaction unless TransactionMode is
+// config.TransactionAll or one of them has the `-- turtle:transaction all` directive, in which case they are applied
+// in a single transaction.
+func (r *Runner) applyPending(ctx context.Context, pending []*Migration) ([]Result, error) {
+	migrations := make([]pendingMigration, len(pending))
+	for i, m := range pending {
+		migrations[i] = pendingMigration{r: r, m: m}
+	}
+	return applyPending(ctx, migrations)
+}
+
+// pendingMigration is a pending migration with the Runner that applies and records it, so that the migrations of
+// several sets can be applied together.
+type pendingMigration struct {
+	set string
+	r   *Runner
+	m   *Migration
+}
+
+// applyPending applies the pending migrations in order, each in its own transaction unless the TransactionMode of one
+// of their runners is config.TransactionAll or one of them has the `-- turtle:transaction all` directive, in which case
+// they are applied in a single transaction.
+func applyPending(ctx context.Context, pending []pendingMigration) ([]Result, error) {
+	results := []Result{}
+
+	queries := make([][]byte, len(pending))
+	all := false
+	noTransaction := ""
+	for i, p := range pending {
+		query, err := p.r.source(p.m, "up")
+		if err != nil {
+			return results, err
+		}
+		d, err := parseDirectives(string(query))
+		if err != nil {
+			return results, &Error{ID: p.m.ID, Direction: "up", Err: err}
+		}
+
+		queries[i] = query
+		all = all || p.r.TransactionMode == config.TransactionAll || d.transactionAll
+		if d.noTransaction && noTransaction == "" {
+			noTransaction = p.m.ID
+		}
+	}
+
+	if all {
+		if noTransaction != "" {
+			return results, &Error{ID: noTransaction, Direction: "up", Err: ErrNoTransactionInBatch}
+		}
+		return applyBatch(ctx, pending, queries)
+	}
+
+	for i, p := range pending {
+		err := p.r.apply(ctx, p.m, queries[i])
+		if err != nil {
+			return results, err
+		}
+		results = append(results, Result{ID: p.m.ID, Direction: "up", Set: p.set})
+	}
+
+	return results, nil
+}
+
+// applyBatch applies the migrations and updates their migration logs in a single transaction, so that either all of
+// them are applied or none are. Without transactional DDL, the statements that ran before a failure may already be
+// committed, which is reported with Error.Unrecorded.
+func applyBatch(ctx context.Context, pending []pendingMigration, queries [][]byte) ([]Result, error) {
+	results := []Result{}
+	if len(pending) == 0 {
+		return results, nil
+	}
+
+	log := pending[0].r.Log
+	last := pending[len(pending)-1]
+	tx, err := log.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return results, &Error{ID: last.m.ID, Direction: "up", Err: err}
+	}
+
+	executed := false
+	for i, p := range pending {
+		fail := func(err error, partial bool) error {
+			return &Error{
+				ID:         p.m.ID,
+				Direction:  "up",
+				Err:        rollback(tx, err),
+				Unrecorded: (executed || partial) && !log.Dialect.TransactionalDDL(),
+			}
+		}
+
+		var duration time.Duration
+		if p.m.isGo() {
+			start := time.Now()
+			err := p.m.Up(ctx, tx)
+			if err != nil {
+				return []Result{}, fail(err, true)
+			}
+			duration = time.Since(start)
+		} else {
+			statements, err := SplitStatements(string(queries[i]), log.Dialect.Syntax())
+			if err != nil {
+				return []Result{}, fail(err, false)
+			}
+			if len(statements) == 0 {
+				return []Result{}, fail(ErrEmptyMigration, false)
+			}
+
+			duration, err = execStatements(ctx, tx, statements)
+			if err != nil {
+				return []Result{}, fail(err, err.(*StatementError).Number > 1)
+			}
+		}
+		executed = true
+
+		err = p.r.Log.InsertWith(ctx, tx, p.r.record(p.m, queries[i], duration))
+		if err != nil {
+			return []Result{}, fail(err, true)
+		}
+
+		results = append(results, Result{ID: p.m.ID, Direction: "up", Set: p.set})
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return []Result{}, &Error{ID: last.m.ID, Direction: "up", Err: err, Unrecorded: !log.Dialect.TransactionalDDL()}
+	}
+
+	return results, nil
+}
+
+// resolveTarget returns the ID of the migration matching the target, either by its ID or its numeric version.
+func resolveTarget(migrations map[string]*Migration, target string) (string, error) {
+	if _, ok := migrations[target]; ok {
+		return target, nil
+	}
+
+	for id := range migrations {
+		match := migrationIDRegex.FindStringSubmatch(id)
+		if match != nil && isDigits(target) && compareVersions(match[1], target) == 0 {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("%v: %s", ErrUnknownMigration, target)
+}
+
+// Migrations returns the migrations in the migration directory and its subdirectories, and the Go migrations, keyed by
+// ID. IDs are unique across the subdirectories, and a migration's files must be in the same directory. An error is
+// returned if two migrations share a numeric version.
+func (r *Runner) Migrations() (map[string]*Migration, error) {
+	migrations, err := r.loadMigrations()
+	if err != nil {
+		return migrations, err
+	}
+
+	sorted := SortMigrations(migrations, "asc")
+	for i := 1; i < len(sorted); i++ {
+		a, b := sorted[i-1].ID, sorted[i].ID
+		if compareVersions(migrationVersion(a), migrationVersion(b)) == 0 {
+			return migrations, fmt.Errorf("%v: %s and %s", ErrDuplicateVersion, a, b)
+		}
+	}
+
+	return migrations, nil
+}
+
+// loadMigrations returns the migration files and Go migrations, without checking their versions.
+func (r *Runner) loadMigrations() (map[string]*Migration, error) {
+	migrations := map[string]*Migration{}
+
+	files, err := walk(r.FS, r.Path)
+	if err != nil {
+		return migrations, err
+	}
+
+	for _, file := range files {
+		name := path.Base(file)
+		if valid(name) {
+			id := migrationID(name)
+			if _, ok := migrations[id]; !ok {
+				migrations[id] = &Migration{
+					ID: id,
+				}
+			}
+			m := migrations[id]
+			if other := m.path(); other != "" && path.Dir(other) != path.Dir(file) {
+				return migrations, fmt.Errorf("%v: %s is in both %s and %s", ErrDuplicateMigration, id, path.Dir(other), path.Dir(file))
+			}
+			if (m.UpPath != "" || m.DownPath != "") && (single(name) || single(m.UpPath) || single(m.DownPath)) {
+				return migrations, fmt.Errorf("%v: %s has both a single migration file and up/down files", ErrDuplicateMigration, id)
+			}
+			m.AddPath(file)
+		}
+	}
+
+	for id, g := range r.GoMigrations {
+		if _, ok := migrations[id]; ok {
+			return migrations, fmt.Errorf("%v: %s is both a migration file and a Go migration", ErrDuplicateMigration, id)
+		}
+		migrations[id] = &Migration{ID: g.ID, Up: g.Up, Down: g.Down}
+	}
+
+	return migrations, nil
+}
+
+// locked runs fn while holding the migration lock, so that concurrent deployments can't migrate simultaneously.
+func (r *Runner) locked(ctx context.Context, fn func(context.Context) ([]Result, error)) ([]Result, error) {
+	lock, err := r.Log.Lock(ctx, r.LockTimeout)
+	if err != nil {
+		return []Result{}, err
+	}
+
+	results, err := fn(ctx)
+
+	// Release the lock even if the context has been cancelled.
+	releaseErr := lock.Release(context.Background())
+	if err == nil {
+		err = releaseErr
+	}
+
+	return results, err
+}
+
+// exec runs the statements of the migration SQL in order in a transaction, along with record, which updates the
+// migration log and is given how long the SQL took to run. A failing statement is reported with a *StatementError. With
+// transactional DDL the migration and the log update are committed atomically. Otherwise the migration's earlier
+// statements may already be committed if a later statement or the log update fails, which is reported with
+// Error.Unrecorded.
+//
+// Migrations with the `-- turtle:no-transaction` directive run outside a transaction, each statement is committed as
+// it runs.
+func (r *Runner) exec(
+	ctx context.Context,
+	id, direction, query string,
+	record func(db.Execer, time.Duration) error,
+) error {
+	fail := func(err error, unrecorded bool) error {
+		return &Error{ID: id, Direction: direction, Err: err, Unrecorded: unrecorded}
+	}
+
+	d, err := parseDirectives(query)
+	if err != nil {
+		return fail(err, false)
+	}
+
+	statements, err := SplitStatements(query, r.Log.Dialect.Syntax())
+	if err != nil {
+		return fail(err, false)
+	}
+	if len(statements) == 0 {
+		return fail(ErrEmptyMigration, false)
+	}
+
+	if d.noTransaction {
+		duration, err := execStatements(ctx, r.Log.Conn, statements)
+		if err != nil {
+			return fail(err, err.(*StatementError).Number > 1)
+		}
+
+		err = record(r.Log.Conn, duration)
+		if err != nil {
+			return fail(err, true)
+		}
+
+		return nil
+	}
+
+	tx, err := r.Log.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err, false)
+	}
+
+	duration, err := execStatements(ctx, tx, statements)
+	if err != nil {
+		return fail(rollback(tx, err), err.(*StatementError).Number > 1 && !r.Log.Dialect.TransactionalDDL())
+	}
+
+	return r.commit(tx, duration, record, fail)
+}
+
+// execGo runs the function of a Go migration in a transaction, along with record, as exec does for SQL. Without
+// transactional DDL, a failing function may have committed some of its changes, so it's reported with
+// Error.Unrecorded.
+func (r *Runner) execGo(
+	ctx context.Context,
+	id, direction string,
+	fn GoFunc,
+	record func(db.Execer, time.Duration) error,
+) error {
+	fail := func(err error, unrecorded bool) error {
+		return &Error{ID: id, Direction: direction, Err: err, Unrecorded: unrecorded}
+	}
+
+	tx, err := r.Log.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err, false)
+	}
+
+	start := time.Now()
+	err = fn(ctx, tx)
+	if err != nil {
+		return fail(rollback(tx, err), !r.Log.Dialect.TransactionalDDL())
+	}
+
+	return r.commit(tx, time.Since(start), record, fail)
+}
+
+// commit updates the migration log in the migration's transaction and commits it.
+func (r *Runner) commit(
+	tx *sql.Tx,
+	duration time.Duration,
+	record func(db.Execer, time.Duration) error,
+	fail func(error, bool) error,
+) error {
+	err := record(tx, duration)
+	if err != nil {
+		return fail(rollback(tx, err), !r.Log.Dialect.TransactionalDDL())
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fail(err, !r.Log.Dialect.TransactionalDDL())
+	}
+
+	return nil
+}
+
+// execStatements runs the statements in order, returning how long they took. A failing statement is returned as a
+// *StatementError.
+func execStatements(ctx context.Context, e db.Execer, statements []Statement) (time.Duration, error) {
+	start := time.Now()
+
+	for i, statement := range statements {
+		_, err := e.ExecContext(ctx, statement.SQL)
+		if err != nil {
+			return 0, &StatementError{Number: i + 1, Line: statement.Line, Err: err}
+		}
+	}
+
+	return time.Since(start), nil
+}
+
+// rollback rolls back the transaction after err, including any error from the roll back.
+func rollback(tx *sql.Tx, err error) error {
+	if rbErr := tx.Rollback(); rbErr != nil {
+		return fmt.Errorf("%v (unable to roll back transaction: %v)", err, rbErr)
+	}
+	return err
+}
+
+// assertTable ensures that the migrations table is present in the database, upgrading it if it was created by an
+// earlier version of turtle.
+func (r *Runner) assertTable(ctx context.Context) error {
+	present, err := r.Log.TablePresent(ctx)
+	if err != nil {
+		return err
+	}
+	if present {
+		return r.Log.Upgrade(ctx)
+	}
+
+	return r.Log.CreateTable(ctx)
+}
+
+// checksum returns the hex encoded SHA-256 checksum of a migration.
+func checksum(query []byte) string {
+	sum := sha256.Sum256(query)
+	return hex.EncodeToString(sum[:])
+}
+
+// upChecksum returns the checksum recorded for the up SQL read from the file at p. Only the up section of a single file
+// migration is checksummed, without the blank lines that stand in for the rest of the file, so that editing the down
+// section doesn't change it.
+func upChecksum(p string, query []byte) string {
+	if single(p) {
+		return checksum(bytes.TrimSpace(query))
+	}
+	return checksum(query)
+}
+
+// appliedBy returns the current user and host as user@host, for the migration log.
+func appliedBy() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+
+	return name + "@" + host
+}
@@ -0,0 +1,177 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/nicday/turtle/config"
+	"github.com/nicday/turtle/db"
+)
+
+// ErrDatabaseNotEmpty is raised when loading a schema into a database that already has applied migrations.
+var ErrDatabaseNotEmpty = errors.New("a schema can only be loaded into a database without applied migrations")
+
+// appliedRegex matches the line recording an applied migration in a schema file.
+var appliedRegex = regexp.MustCompile(`^--\s*turtle:applied\s+(\S+)\s*$`)
+
+// DumpSchema writes the schema of the database, without the migrations table, followed by the IDs of the applied
+// migrations.
+func (r *Runner) DumpSchema(ctx context.Context, w io.Writer) error {
+	statements, err := r.Log.DumpSchema(ctx)
+	if err != nil {
+		return err
+	}
+
+	records := []db.Record{}
+	present, err := r.Log.TablePresent(ctx)
+	if err != nil {
+		return err
+	}
+	if present {
+		records, err = r.Log.Applied(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(
+		w,
+		"-- Schema dumped by turtle %s, load it into a fresh database with `turtle schema load`.\n\n",
+		config.Version,
+	)
+	for _, statement := range statements {
+		fmt.Fprintf(w, "%s;\n\n", strings.TrimSpace(statement))
+	}
+	for _, record := range records {
+		fmt.Fprintf(w, "-- turtle:applied %s\n", record.ID)
+	}
+
+	return nil
+}
+
+// LoadSchema runs a schema written by DumpSchema and records its migrations as applied, in a single transaction. The
+// database must not have any applied migrations. The recorded checksums are of the migrations in the migration
+// directory, so that they validate.
+func (r *Runner) LoadSchema(ctx context.Context, rd io.Reader) ([]Result, error) {
+	query, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return []Result{}, err
+	}
+
+	ids := []string{}
+	for _, line := range strings.Split(string(query), "\n") {
+		if match := appliedRegex.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			ids = append(ids, match[1])
+		}
+	}
+
+	statements, err := SplitStatements(string(query), r.Log.Dialect.Syntax())
+	if err != nil {
+		return []Result{}, err
+	}
+
+	return r.locked(ctx, func(ctx context.Context) ([]Result, error) {
+		return r.loadSchema(ctx, statements, ids)
+	})
+}
+
+// loadSchema runs the schema statements and records the migrations as applied.
+func (r *Runner) loadSchema(ctx context.Context, statements []Statement, ids []string) ([]Result, error) {
+	results := []Result{}
+
+	err := r.assertTable(ctx)
+	if err != nil {
+		return results, err
+	}
+
+	records, err := r.Log.Applied(ctx)
+	if err != nil {
+		return results, err
+	}
+	if len(records) > 0 {
+		return results, ErrDatabaseNotEmpty
+	}
+
+	migrations, err := r.Migrations()
+	if err != nil {
+		return results, err
+	}
+
+	tx, err := r.Log.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return results, err
+	}
+
+	_, err = execStatements(ctx, tx, statements)
+	if err != nil {
+		return results, rollback(tx, err)
+	}
+
+	for _, id := range ids {
+		record := db.Record{ID: id, Version: config.Version, AppliedBy: appliedBy()}
+		if m, ok := migrations[id]; ok {
+			query, err := r.source(m, "up")
+			if err != nil {
+				return []Result{}, rollback(tx, err)
+			}
+			record = r.record(m, query, 0)
+		}
+
+		err := r.Log.InsertWith(ctx, tx, record)
+		if err != nil {
+			return []Result{}, rollback(tx, err)
+		}
+		results = append(results, Result{ID: id, Direction: "up"})
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return []Result{}, err
+	}
+
+	return results, nil
+}
+
+// DumpSchema writes the schema file to config.SchemaPath. The file is left unchanged if the schema can't be dumped.
+func DumpSchema() error {
+	var b bytes.Buffer
+	err := DefaultRunner().DumpSchema(context.Background(), &b)
+	if err == nil {
+		err = ioutil.WriteFile(config.SchemaPath, b.Bytes(), 0644)
+	}
+	if err != nil {
+		log.Printf("[Error] unable to dump schema: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// LoadSchema loads the schema file at config.SchemaPath into a fresh database.
+func LoadSchema() error {
+	f, err := os.Open(config.SchemaPath)
+	if err != nil {
+		log.Printf("[Error] %v", err)
+		return err
+	}
+	defer f.Close()
+
+	results, err := DefaultRunner().LoadSchema(context.Background(), f)
+	for _, r := range results {
+		fmt.Printf("Migration (%s) marked as applied\n", r.ID)
+	}
+	if err != nil {
+		log.Printf("[Error] %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/nicday/turtle/config"
+	"github.com/nicday/turtle/db"
+)
+
+// ErrGoMigrationScript is raised when a script would include a Go migration, which can only be run by turtle.
+var ErrGoMigrationScript = errors.New("Go migrations can't be written to a script")
+
+// ScriptOptions selects the migrations included in a script.
+type ScriptOptions struct {
+	// From is the migration the database is currently at, as an ID or numeric version. Up scripts start after it and
+	// default to the first migration; down scripts start by reverting it and default to the latest migration.
+	From string
+
+	// To is the migration the database should be at once the script has run, as an ID or numeric version. Up scripts
+	// apply up to and including it and default to the latest migration; down scripts revert the migrations newer than
+	// it and default to reverting them all.
+	To string
+
+	// Transaction is config.TransactionPerMigration to wrap each migration and its migrations table update in BEGIN and
+	// COMMIT, except migrations with the `-- turtle:no-transaction` directive, or config.TransactionAll to wrap all of
+	// them in a single transaction. The script has no transactions when it's empty.
+	Transaction string
+}
+
+// Script writes a SQL script that applies (`up`) or reverts (`down`) the selected migrations, along with the
+// statements that update the migrations table, for the dialect of the runner's log. The database isn't queried, so
+// the script can be reviewed and run by hand. Up scripts create the migrations table if it's missing.
+func (r *Runner) Script(w io.Writer, direction string, opts ScriptOptions) error {
+	migrations, err := r.Migrations()
+	if err != nil {
+		return err
+	}
+
+	selected, err := scriptMigrations(migrations, direction, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range selected {
+		if m.isGo() {
+			return &Error{ID: m.ID, Direction: direction, Err: ErrGoMigrationScript}
+		}
+	}
+
+	if opts.Transaction != "" && opts.Transaction != config.TransactionPerMigration &&
+		opts.Transaction != config.TransactionAll {
+		return config.ErrInvalidTransactionMode
+	}
+
+	steps, err := r.steps(selected, direction)
+	if err != nil {
+		return err
+	}
+
+	parsed := make([]directives, len(steps))
+	for i, s := range steps {
+		parsed[i], err = parseDirectives(s.SQL)
+		if err != nil {
+			return &Error{ID: s.ID, Direction: direction, Err: err}
+		}
+		if opts.Transaction == config.TransactionAll && parsed[i].noTransaction {
+			return &Error{ID: s.ID, Direction: direction, Err: ErrNoTransactionInBatch}
+		}
+	}
+
+	fmt.Fprintf(w, "-- Generated by turtle %s: %s %d migration(s)\n\n", config.Version, direction, len(steps))
+	if direction == "up" {
+		fmt.Fprintf(w, "%s;\n\n", r.Log.CreateTableStatement())
+	}
+	if opts.Transaction == config.TransactionAll {
+		fmt.Fprint(w, "BEGIN;\n\n")
+	}
+
+	for i, s := range steps {
+		record := r.Log.DeleteStatement(s.ID)
+		if direction == "up" {
+			record = r.Log.InsertStatement(db.Record{
+				ID:       s.ID,
+				Checksum: upChecksum(s.Path, []byte(s.SQL)),
+				Version:  config.Version,
+			})
+		}
+
+		transaction := opts.Transaction == config.TransactionPerMigration && !parsed[i].noTransaction
+
+		fmt.Fprintf(w, "-- Migration (%s) %s: %s\n", s.ID, direction, s.Path)
+		if transaction {
+			fmt.Fprintln(w, "BEGIN;")
+		}
+		fmt.Fprintln(w, terminate(s.SQL, r.Log.Dialect.Syntax()))
+		fmt.Fprintf(w, "%s;\n", record)
+		if transaction {
+			fmt.Fprintln(w, "COMMIT;")
+		}
+		fmt.Fprintln(w)
+	}
+
+	if opts.Transaction == config.TransactionAll {
+		fmt.Fprintln(w, "COMMIT;")
+	}
+
+	return nil
+}
+
+// WriteScript writes a SQL script that applies (`up`) or reverts (`down`) the selected migrations.
+func WriteScript(w io.Writer, direction string, opts ScriptOptions) error {
+	err := DefaultRunner().Script(w, direction, opts)
+	if err != nil {
+		log.Printf("[Error] %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// scriptMigrations returns the migrations selected by the options, in the order the direction runs them.
+func scriptMigrations(migrations map[string]*Migration, direction string, opts ScriptOptions) ([]*Migration, error) {
+	sorted := SortMigrations(migrations, "asc")
+
+	// position returns the index of the target in the sorted migrations, or def if there's no target.
+	position := func(target string, def int) (int, error) {
+		if target == "" {
+			return def, nil
+		}
+		id, err := resolveTarget(migrations, target)
+		if err != nil {
+			return 0, err
+		}
+		for i, m := range sorted {
+			if m.ID == id {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%v: %s", ErrUnknownMigration, target)
+	}
+
+	selected := []*Migration{}
+
+	switch direction {
+	case "up":
+		from, err := position(opts.From, -1)
+		if err != nil {
+			return selected, err
+		}
+		to, err := position(opts.To, len(sorted)-1)
+		if err != nil {
+			return selected, err
+		}
+		for i := from + 1; i <= to; i++ {
+			selected = append(selected, sorted[i])
+		}
+	case "down":
+		from, err := position(opts.From, len(sorted)-1)
+		if err != nil {
+			return selected, err
+		}
+		to, err := position(opts.To, -1)
+		if err != nil {
+			return selected, err
+		}
+		for i := from; i > to; i-- {
+			selected = append(selected, sorted[i])
+		}
+	default:
+		return selected, fmt.Errorf("unknown direction %q, expected up or down", direction)
+	}
+
+	return selected, nil
+}
+
+// terminate ensures the last statement of the migration SQL ends with a semicolon, so that the statement after it in a
+// script is separate. When the migration ends with a line comment, the semicolon goes on a line of its own.
+func terminate(query string, syntax db.Syntax) string {
+	query = strings.TrimSpace(query)
+	for _, terminated := range []string{query, query + ";"} {
+		if isTerminated(terminated, syntax) {
+			return terminated
+		}
+	}
+	return query + "\n;"
+}
+
+// isTerminated returns true if the last statement of the query is terminated, so a statement on the next line would be
+// split from it.
+func isTerminated(query string, syntax db.Syntax) bool {
+	statements, err := SplitStatements(query, syntax)
+	if err != nil {
+		return false
+	}
+	next, err := SplitStatements(query+"\nSELECT 1", syntax)
+	return err == nil && len(next) > len(statements)
+}
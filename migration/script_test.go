@@ -0,0 +1,99 @@
+package migration_test
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/nicday/turtle/config"
+	. "github.com/nicday/turtle/migration"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Script", func() {
+	Describe(".WriteScript", func() {
+		Context("with `up` direction", func() {
+			It("writes the migrations after `from` up to and including `to` with the migrations table inserts", func() {
+				out := &bytes.Buffer{}
+				err := WriteScript(out, "up", ScriptOptions{From: "20150703234300001", To: "20150703234300002_second"})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(out.String()).To(Equal(fmt.Sprintf(
+					"-- Generated by turtle %s: up 1 migration(s)\n\n"+
+						"CREATE TABLE IF NOT EXISTS `migrations` (id INT NOT NULL AUTO_INCREMENT, migration_id VARCHAR(255) NOT NULL UNIQUE, "+
+						"applied_at TIMESTAMP NULL, checksum VARCHAR(64) NULL, duration_ms BIGINT NULL, turtle_version VARCHAR(32) NULL, "+
+						"applied_by VARCHAR(255) NULL, PRIMARY KEY(id));\n\n"+
+						"-- Migration (20150703234300002_second) up: migrations/20150703234300002_second_up.sql\n"+
+						"CREATE TABLE second;\n"+
+						"INSERT INTO `migrations` (migration_id, applied_at, checksum, duration_ms, turtle_version, applied_by) "+
+						"VALUES ('20150703234300002_second', CURRENT_TIMESTAMP, '%s', NULL, '%s', NULL);\n\n",
+					config.Version,
+					checksum("CREATE TABLE second"),
+					config.Version,
+				)))
+			})
+		})
+
+		Context("with `down` direction", func() {
+			It("writes the migrations newer than `to` in reverse order, wrapped in transactions", func() {
+				out := &bytes.Buffer{}
+				err := WriteScript(out, "down", ScriptOptions{
+					To:          "20150703234300001",
+					Transaction: config.TransactionPerMigration,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(out.String()).To(Equal(fmt.Sprintf(
+					"-- Generated by turtle %s: down 2 migration(s)\n\n"+
+						"-- Migration (20150703234300003_third) down: migrations/20150703234300003_third_down.sql\n"+
+						"BEGIN;\n"+
+						"DROP TABLE third;\n"+
+						"DELETE FROM `migrations` WHERE migration_id='20150703234300003_third';\n"+
+						"COMMIT;\n\n"+
+						"-- Migration (20150703234300002_second) down: migrations/20150703234300002_second_down.sql\n"+
+						"BEGIN;\n"+
+						"DROP TABLE second;\n"+
+						"DELETE FROM `migrations` WHERE migration_id='20150703234300002_second';\n"+
+						"COMMIT;\n\n",
+					config.Version,
+				)))
+			})
+		})
+
+		Context("with all the migrations in one transaction", func() {
+			It("wraps the migrations in BEGIN and COMMIT", func() {
+				out := &bytes.Buffer{}
+				err := WriteScript(out, "down", ScriptOptions{To: "20150703234300001", Transaction: config.TransactionAll})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(out.String()).To(Equal(fmt.Sprintf(
+					"-- Generated by turtle %s: down 2 migration(s)\n\n"+
+						"BEGIN;\n\n"+
+						"-- Migration (20150703234300003_third) down: migrations/20150703234300003_third_down.sql\n"+
+						"DROP TABLE third;\n"+
+						"DELETE FROM `migrations` WHERE migration_id='20150703234300003_third';\n\n"+
+						"-- Migration (20150703234300002_second) down: migrations/20150703234300002_second_down.sql\n"+
+						"DROP TABLE second;\n"+
+						"DELETE FROM `migrations` WHERE migration_id='20150703234300002_second';\n\n"+
+						"COMMIT;\n",
+					config.Version,
+				)))
+			})
+		})
+
+		Context("with an unknown transaction mode", func() {
+			It("returns an error", func() {
+				err := WriteScript(&bytes.Buffer{}, "up", ScriptOptions{Transaction: "each"})
+				Expect(err).To(Equal(config.ErrInvalidTransactionMode))
+			})
+		})
+
+		Context("with an unknown migration", func() {
+			It("returns an error", func() {
+				err := WriteScript(&bytes.Buffer{}, "up", ScriptOptions{To: "20150703234300009"})
+				Expect(err).To(MatchError(ContainSubstring(ErrUnknownMigration.Error())))
+			})
+		})
+	})
+})
@@ -0,0 +1,187 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/nicday/turtle/config"
+	"github.com/nicday/turtle/db"
+)
+
+// Set is a named directory of migrations, one of several sharing a database. Each set is recorded in its own
+// migrations table, so its migrations are applied and reverted independently of the other sets.
+type Set struct {
+	Name   string
+	Runner *Runner
+}
+
+// Sets runs the migrations of several sets in a single order by ID, as if they were in one directory. Migrations with
+// the same ID are run in the order of the sets.
+type Sets []Set
+
+// setMigration is a migration of one of the sets.
+type setMigration struct {
+	set *Set
+	m   *Migration
+}
+
+// NewSets initializes a Set for each of the migration sets, using the active FileSystem and the package connection.
+// Each set runs the Go migrations added to it with RegisterSet.
+func NewSets(sets []config.MigrationSet) Sets {
+	s := Sets{}
+	for _, set := range sets {
+		l := db.NewLog(db.Conn, db.CurrentDialect(), set.Table)
+		r := NewRunner(FS, set.Path, l)
+		r.GoMigrations = goMigrations(set.Name)
+		s = append(s, Set{Name: set.Name, Runner: r})
+	}
+	return s
+}
+
+// DefaultSets returns the configured migration sets.
+func DefaultSets() Sets {
+	return NewSets(config.MigrationSets)
+}
+
+// ApplyAll applies the pending migrations of all the sets in order by ID. Each set is checked as Runner.ApplyAll
+// would before anything is applied, and its out of order policy is applied to its own migrations. As with a single
+// set, the migrations are applied in one transaction when a set's TransactionMode is config.TransactionAll or a
+// migration has the `-- turtle:transaction all` directive. The applied migrations are returned, including when an
+// error stops the run part way through.
+func (s Sets) ApplyAll(ctx context.Context) ([]Result, error) {
+	return s.locked(ctx, 0, s.applyAll)
+}
+
+func (s Sets) applyAll(ctx context.Context) ([]Result, error) {
+	results := []Result{}
+
+	pending := []pendingMigration{}
+	late := map[string]map[string]bool{}
+	for i := range s {
+		set := &s[i]
+		r := set.Runner
+
+		err := r.assertTable(ctx)
+		if err != nil {
+			return results, err
+		}
+
+		err = r.validate(ctx)
+		if err != nil {
+			return results, err
+		}
+
+		migrations, err := r.Migrations()
+		if err != nil {
+			return results, err
+		}
+
+		sorted := SortMigrations(migrations, "asc")
+		setPending, err := r.pending(ctx, sorted)
+		if err != nil {
+			return results, err
+		}
+
+		late[set.Name], err = r.checkOrder(sorted, setPending)
+		if err != nil {
+			return results, fmt.Errorf("%s: %v", set.Name, err)
+		}
+
+		for _, m := range setPending {
+			pending = append(pending, pendingMigration{set: set.Name, r: r, m: m})
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool { return lessID(pending[i].m.ID, pending[j].m.ID) })
+
+	applied, err := applyPending(ctx, pending)
+	for _, result := range applied {
+		result.OutOfOrder = late[result.Set][result.ID]
+		results = append(results, result)
+	}
+	if err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+// RevertAll reverts the active migrations of all the sets in reverse order by ID. The reverted migrations are
+// returned, including when an error stops the run part way through.
+func (s Sets) RevertAll(ctx context.Context) ([]Result, error) {
+	return s.locked(ctx, 0, s.revertAll)
+}
+
+func (s Sets) revertAll(ctx context.Context) ([]Result, error) {
+	results := []Result{}
+
+	all := []setMigration{}
+	for i := range s {
+		set := &s[i]
+
+		err := set.Runner.assertTable(ctx)
+		if err != nil {
+			return results, err
+		}
+
+		migrations, err := set.Runner.Migrations()
+		if err != nil {
+			return results, err
+		}
+
+		for _, m := range SortMigrations(migrations, "asc") {
+			all = append(all, setMigration{set: set, m: m})
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool { return lessID(all[i].m.ID, all[j].m.ID) })
+
+	for i := len(all) - 1; i >= 0; i-- {
+		p := all[i]
+		reverted, err := p.set.Runner.Revert(ctx, p.m)
+		if err != nil {
+			return results, err
+		}
+		if reverted {
+			results = append(results, Result{ID: p.m.ID, Direction: "down", Set: p.set.Name})
+		}
+	}
+
+	return results, nil
+}
+
+// locked runs fn while holding the migration lock of every set from the i-th, taking them in the order of the sets.
+func (s Sets) locked(ctx context.Context, i int, fn func(context.Context) ([]Result, error)) ([]Result, error) {
+	if i == len(s) {
+		return fn(ctx)
+	}
+	return s[i].Runner.locked(ctx, func(ctx context.Context) ([]Result, error) {
+		return s.locked(ctx, i+1, fn)
+	})
+}
+
+// ApplyAllSets applies the migrations of all the configured migration sets in order by ID.
+func ApplyAllSets() error {
+	results, err := DefaultSets().ApplyAll(context.Background())
+	printResults(results)
+	if err != nil {
+		log.Printf("[Error] %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// RevertAllSets reverts the migrations of all the configured migration sets in reverse order by ID.
+func RevertAllSets() error {
+	results, err := DefaultSets().RevertAll(context.Background())
+	printResults(results)
+	if err != nil {
+		log.Printf("[Error] %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrNoUpSection is raised when a single file migration doesn't have a `-- +turtle Up` section.
+	ErrNoUpSection = errors.New("missing `-- +turtle Up` section")
+
+	// singleMigrationRegex matches a migration file containing both directions, e.g. 20150703_users.sql.
+	singleMigrationRegex = regexp.MustCompile(`^(\d+)_([\w-]+)\.sql$`)
+
+	// sectionRegex matches a `-- +turtle <section>` comment.
+	sectionRegex = regexp.MustCompile(`^--\s*\+turtle\s+(\S+)\s*$`)
+)
+
+// single returns true if the migration file contains both directions, in `-- +turtle Up` and `-- +turtle Down`
+// sections.
+func single(filename string) bool {
+	filename = path.Base(filename)
+	if upMigrationRegex.MatchString(filename) || downMigrationRegex.MatchString(filename) {
+		return false
+	}
+	return singleMigrationRegex.MatchString(filename)
+}
+
+// section returns the SQL for the direction from a single file migration. Lines outside the section are blanked,
+// rather than removed, so that line numbers in errors match the file. A missing Down section means the migration
+// can't be reverted.
+func section(query []byte, direction string) ([]byte, error) {
+	lines := strings.Split(string(query), "\n")
+	found := map[string]bool{}
+	current := ""
+
+	for i, line := range lines {
+		match := sectionRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match != nil {
+			name := strings.ToLower(match[1])
+			if name != "up" && name != "down" {
+				return nil, fmt.Errorf("line %d: unknown section +turtle %s", i+1, match[1])
+			}
+			if found[name] {
+				return nil, fmt.Errorf("line %d: duplicate section +turtle %s", i+1, match[1])
+			}
+			found[name] = true
+			current = name
+			lines[i] = ""
+			continue
+		}
+
+		if current == "" && strings.TrimSpace(line) != "" && !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			return nil, fmt.Errorf("line %d: SQL before the `-- +turtle Up` section", i+1)
+		}
+		if current != direction {
+			lines[i] = ""
+		}
+	}
+
+	if !found["up"] {
+		return nil, ErrNoUpSection
+	}
+	if !found[direction] {
+		return nil, ErrIrreversible
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
@@ -1,6 +1,9 @@
 package migration
 
-import "sort"
+import (
+	"sort"
+	"strings"
+)
 
 type sortedMigrations struct {
 	migrations map[string]*Migration
@@ -14,15 +17,17 @@ func (s *sortedMigrations) Len() int {
 
 func (s *sortedMigrations) Less(i, j int) bool {
 	if s.direction == "desc" {
-		return s.migrations[s.sorted[i].ID].ID > s.migrations[s.sorted[j].ID].ID
+		return lessID(s.sorted[j].ID, s.sorted[i].ID)
 	}
-	return s.migrations[s.sorted[i].ID].ID < s.migrations[s.sorted[j].ID].ID
+	return lessID(s.sorted[i].ID, s.sorted[j].ID)
 }
 
 func (s *sortedMigrations) Swap(i, j int) {
 	s.sorted[i], s.sorted[j] = s.sorted[j], s.sorted[i]
 }
 
+// SortMigrations returns the migrations ordered by the numeric value of their versions and then by name, so that
+// sequential IDs such as 9 and 10 sort correctly, in ascending order unless the direction is `desc`.
 func SortMigrations(migrations map[string]*Migration, direction string) []*Migration {
 	s := sortedMigrations{}
 	s.migrations = migrations
@@ -36,3 +41,57 @@ func SortMigrations(migrations map[string]*Migration, direction string) []*Migra
 	sort.Sort(&s)
 	return s.sorted
 }
+
+// lessID returns true if the migration ID a sorts before b, by the numeric value of their versions, then by their
+// names. IDs that only differ in leading zeros are ordered by ID, so that the order is always the same.
+func lessID(a string, b string) bool {
+	matchA := migrationIDRegex.FindStringSubmatch(a)
+	matchB := migrationIDRegex.FindStringSubmatch(b)
+	if matchA == nil || matchB == nil {
+		return a < b
+	}
+
+	if c := compareVersions(matchA[1], matchB[1]); c != 0 {
+		return c < 0
+	}
+	if matchA[2] != matchB[2] {
+		return matchA[2] < matchB[2]
+	}
+	return a < b
+}
+
+// migrationVersion returns the numeric version the migration ID starts with.
+func migrationVersion(id string) string {
+	match := migrationIDRegex.FindStringSubmatch(id)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// isDigits returns true if s is a non-empty string of digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// compareVersions compares two numeric versions by their value, returning -1, 0 or 1. Versions can be longer than an
+// int64 and leading zeros are ignored.
+func compareVersions(a string, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -59,5 +59,35 @@ var _ = Describe("Sort", func() {
 				Expect(SortMigrations(migrations, "unexpected")).To(Equal(expected))
 			})
 		})
+
+		Context("with sequential IDs", func() {
+			It("sorts the versions numerically", func() {
+				ninth := &Migration{ID: "0009_ninth"}
+				tenth := &Migration{ID: "0010_tenth"}
+				hundredth := &Migration{ID: "100_hundredth"}
+
+				sorted := SortMigrations(map[string]*Migration{
+					"100_hundredth": hundredth,
+					"0010_tenth":    tenth,
+					"0009_ninth":    ninth,
+				}, "asc")
+				Expect(sorted).To(Equal([]*Migration{ninth, tenth, hundredth}))
+			})
+		})
+
+		Context("with IDs sharing a version", func() {
+			It("sorts by name", func() {
+				dashed := &Migration{ID: "20150703_a-b"}
+				underscored := &Migration{ID: "20150703_a_b"}
+				padded := &Migration{ID: "020150703_a_b"}
+
+				sorted := SortMigrations(map[string]*Migration{
+					"20150703_a_b":  underscored,
+					"020150703_a_b": padded,
+					"20150703_a-b":  dashed,
+				}, "asc")
+				Expect(sorted).To(Equal([]*Migration{dashed, padded, underscored}))
+			})
+		})
 	})
 })
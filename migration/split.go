@@ -0,0 +1,259 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nicday/turtle/db"
+)
+
+const defaultDelimiter = ";"
+
+var (
+	dollarQuoteRegex = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+	delimiterRegex   = regexp.MustCompile(`(?i)^DELIMITER[ \t]+(\S*)[ \t]*(\r?\n|$)`)
+)
+
+// Statement is a single SQL statement from a migration.
+type Statement struct {
+	SQL string
+
+	// Line is the line of the migration file the statement starts on.
+	Line int
+}
+
+// StatementError is returned when a statement of a migration fails.
+type StatementError struct {
+	// Number is the position of the statement in the migration, starting at 1.
+	Number int
+	Line   int
+	Err    error
+}
+
+// Error satisfies the error interface.
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %d (line %d): %v", e.Number, e.Line, e.Err)
+}
+
+// SplitStatements splits a migration into its statements, following the lexical rules of the dialect's syntax.
+// Delimiters inside quotes and comments are ignored, and a `DELIMITER` line changes the delimiter for the statements
+// after it, as in the MySQL client, so that stored procedure bodies can contain semicolons. With trigger blocks the
+// `BEGIN ... END` body of a CREATE TRIGGER statement is part of the statement. Statements containing only comments are
+// dropped.
+func SplitStatements(query string, syntax db.Syntax) ([]Statement, error) {
+	s := splitter{query: query, syntax: syntax, delimiter: defaultDelimiter, line: 1}
+	return s.split()
+}
+
+// splitter scans a migration for statement delimiters.
+type splitter struct {
+	query     string
+	syntax    db.Syntax
+	delimiter string
+
+	// pos is the offset of the next byte to scan, and line is its line number.
+	pos  int
+	line int
+
+	// words are the first words of the current statement, used to recognise CREATE TRIGGER, and depth is the number
+	// of open BEGIN and CASE blocks in a trigger's body.
+	words []string
+	depth int
+}
+
+func (s *splitter) split() ([]Statement, error) {
+	statements := []Statement{}
+
+	// start is the offset of the current statement, and startLine is the line of its first token, or 0 until one is
+	// found.
+	start, startLine := 0, 0
+	end := func(offset int) {
+		if startLine > 0 {
+			statements = append(statements, Statement{
+				SQL:  strings.TrimSpace(s.query[start:offset]),
+				Line: startLine,
+			})
+		}
+		startLine = 0
+		s.words = nil
+		s.depth = 0
+	}
+	token := func() {
+		if startLine == 0 {
+			startLine = s.line
+		}
+	}
+
+	for s.pos < len(s.query) {
+		rest := s.query[s.pos:]
+		c := rest[0]
+
+		switch {
+		case c == '\n':
+			s.line++
+			s.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			s.pos++
+		case startLine == 0 && delimiterRegex.MatchString(rest):
+			match := delimiterRegex.FindStringSubmatch(rest)
+			if match[1] == "" {
+				return statements, fmt.Errorf("line %d: DELIMITER requires a delimiter", s.line)
+			}
+			s.delimiter = match[1]
+			s.advance(len(match[0]))
+			start = s.pos
+		case c == '\'' || c == '"' || c == '`':
+			token()
+			err := s.skipQuoted(c, s.syntax.BackslashEscapes)
+			if err != nil {
+				return statements, err
+			}
+		case (c == 'E' || c == 'e') && strings.HasPrefix(rest[1:], "'") && s.syntax.EscapeStrings && !s.inWord():
+			token()
+			s.pos++
+			err := s.skipQuoted('\'', true)
+			if err != nil {
+				return statements, err
+			}
+		case strings.HasPrefix(rest, "--") || (c == '#' && s.syntax.HashComments):
+			s.skipTo("\n", false)
+		case strings.HasPrefix(rest, "/*"):
+			// MySQL executes the contents of `/*! ... */` comments, so they are part of the statement.
+			if strings.HasPrefix(rest, "/*!") {
+				token()
+			}
+			line := s.line
+			if !s.skipTo("*/", true) {
+				return statements, fmt.Errorf("line %d: unterminated comment", line)
+			}
+		case strings.HasPrefix(rest, s.delimiter) && s.depth == 0:
+			end(s.pos)
+			s.pos += len(s.delimiter)
+			start = s.pos
+		case c == '$' && s.syntax.DollarQuoting && dollarQuoteRegex.MatchString(rest) && !s.inWord():
+			token()
+			tag := dollarQuoteRegex.FindString(rest)
+			line := s.line
+			s.advance(len(tag))
+			if !s.skipTo(tag, true) {
+				return statements, fmt.Errorf("line %d: unterminated dollar-quoted string", line)
+			}
+		case s.syntax.TriggerBlocks && isWordByte(c) && !s.inWord():
+			token()
+			s.word()
+		default:
+			token()
+			s.pos++
+		}
+	}
+	end(len(s.query))
+
+	return statements, nil
+}
+
+// skipQuoted skips past the quoted string starting at pos. A doubled quote character is an escaped quote, as is a
+// backslash escaped one when backslashes are escapes.
+func (s *splitter) skipQuoted(quote byte, backslashes bool) error {
+	line := s.line
+	s.pos++
+
+	for s.pos < len(s.query) {
+		c := s.query[s.pos]
+		switch {
+		case c == '\\' && quote != '`' && backslashes:
+			s.advance(2)
+		case c == quote && s.pos+1 < len(s.query) && s.query[s.pos+1] == quote:
+			s.pos += 2
+		case c == quote:
+			s.pos++
+			return nil
+		default:
+			s.advance(1)
+		}
+	}
+
+	return fmt.Errorf("line %d: unterminated quoted string", line)
+}
+
+// skipTo skips past the next occurrence of end, or to the end of the query if there isn't one. False is returned if end
+// is required but wasn't found; a line comment on the last line doesn't need a trailing newline, so isn't required.
+func (s *splitter) skipTo(end string, required bool) bool {
+	i := strings.Index(s.query[s.pos:], end)
+	if i < 0 {
+		s.advance(len(s.query) - s.pos)
+		return !required
+	}
+
+	// A line comment ends before the newline, so that it's counted by the scanner.
+	if end == "\n" {
+		s.advance(i)
+		return true
+	}
+
+	s.advance(i + len(end))
+	return true
+}
+
+// advance moves pos forward n bytes, counting the lines passed.
+func (s *splitter) advance(n int) {
+	if s.pos+n > len(s.query) {
+		n = len(s.query) - s.pos
+	}
+	s.line += strings.Count(s.query[s.pos:s.pos+n], "\n")
+	s.pos += n
+}
+
+// word scans the word at pos, tracking the `BEGIN ... END` blocks of CREATE TRIGGER statements so that the
+// delimiters inside them don't end the statement. CASE expressions also end with END, so they are counted too.
+func (s *splitter) word() {
+	n := 1
+	for s.pos+n < len(s.query) && isWordByte(s.query[s.pos+n]) {
+		n++
+	}
+	w := strings.ToUpper(s.query[s.pos : s.pos+n])
+	s.pos += n
+
+	if len(s.words) < 3 {
+		s.words = append(s.words, w)
+	}
+	if !s.trigger() {
+		return
+	}
+
+	switch w {
+	case "BEGIN", "CASE":
+		s.depth++
+	case "END":
+		if s.depth > 0 {
+			s.depth--
+		}
+	}
+}
+
+// trigger returns true if the current statement is CREATE [TEMP|TEMPORARY] TRIGGER.
+func (s *splitter) trigger() bool {
+	switch {
+	case len(s.words) < 2 || s.words[0] != "CREATE":
+		return false
+	case s.words[1] == "TRIGGER":
+		return true
+	default:
+		return len(s.words) == 3 && (s.words[1] == "TEMP" || s.words[1] == "TEMPORARY") && s.words[2] == "TRIGGER"
+	}
+}
+
+// isWordByte returns true if c can be part of an unquoted keyword or identifier.
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// inWord returns true if the byte before pos is part of an identifier, in which case a `$` is part of the identifier
+// rather than the start of a dollar-quoted string.
+func (s *splitter) inWord() bool {
+	if s.pos == 0 {
+		return false
+	}
+	c := s.query[s.pos-1]
+	return c == '_' || c == '$' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,121 @@
+package migration_test
+
+import (
+	"github.com/nicday/turtle/db"
+	. "github.com/nicday/turtle/migration"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Split", func() {
+	Describe(".SplitStatements", func() {
+		mysql := db.Syntax{BackslashEscapes: true, HashComments: true}
+		postgres := db.Syntax{DollarQuoting: true, EscapeStrings: true}
+		sqlite := db.Syntax{TriggerBlocks: true}
+
+		It("splits statements on semicolons, recording the line each starts on", func() {
+			statements, err := SplitStatements("CREATE TABLE a (id INT);\n\nCREATE TABLE b (id INT);\n", mysql)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(Equal([]Statement{
+				{SQL: "CREATE TABLE a (id INT)", Line: 1},
+				{SQL: "CREATE TABLE b (id INT)", Line: 3},
+			}))
+		})
+
+		It("ignores semicolons in quotes and comments", func() {
+			query := "-- first; statement\n" +
+				"INSERT INTO a VALUES ('x;y', 'it''s', \"a;b\", `c;d`); /* a ; comment */\n" +
+				"# another; comment\n" +
+				"INSERT INTO a VALUES ('\\';')"
+
+			statements, err := SplitStatements(query, mysql)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(Equal([]Statement{
+				{SQL: "-- first; statement\nINSERT INTO a VALUES ('x;y', 'it''s', \"a;b\", `c;d`)", Line: 2},
+				{SQL: "/* a ; comment */\n# another; comment\nINSERT INTO a VALUES ('\\';')", Line: 4},
+			}))
+		})
+
+		It("drops statements containing only comments", func() {
+			statements, err := SplitStatements("CREATE TABLE a (id INT);\n-- done\n", mysql)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(HaveLen(1))
+		})
+
+		It("keeps MySQL executable comments", func() {
+			statements, err := SplitStatements("/*!40101 SET NAMES utf8 */;", mysql)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(Equal([]Statement{{SQL: "/*!40101 SET NAMES utf8 */", Line: 1}}))
+		})
+
+		It("changes the delimiter on DELIMITER lines", func() {
+			query := "DELIMITER //\n" +
+				"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END//\n" +
+				"DELIMITER ;\n" +
+				"CALL p();\n"
+
+			statements, err := SplitStatements(query, mysql)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(Equal([]Statement{
+				{SQL: "CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", Line: 2},
+				{SQL: "CALL p()", Line: 4},
+			}))
+		})
+
+		It("ignores semicolons in dollar-quoted strings", func() {
+			query := "CREATE FUNCTION f() RETURNS int AS $body$\nBEGIN RETURN 1; END;\n$body$ LANGUAGE plpgsql;\n" +
+				"SELECT $$a;b$$, $1;"
+
+			statements, err := SplitStatements(query, postgres)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(Equal([]Statement{
+				{SQL: "CREATE FUNCTION f() RETURNS int AS $body$\nBEGIN RETURN 1; END;\n$body$ LANGUAGE plpgsql", Line: 1},
+				{SQL: "SELECT $$a;b$$, $1", Line: 4},
+			}))
+		})
+
+		It("treats backslashes literally without backslash escapes", func() {
+			statements, err := SplitStatements(`INSERT INTO a VALUES ('C:\'); SELECT 1`, postgres)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(HaveLen(2))
+		})
+
+		It("treats backslashes as escapes in PostgreSQL escape strings", func() {
+			statements, err := SplitStatements(`INSERT INTO a VALUES (E'it\'s; fine', e'\\'); SELECT 1`, postgres)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(Equal([]Statement{
+				{SQL: `INSERT INTO a VALUES (E'it\'s; fine', e'\\')`, Line: 1},
+				{SQL: "SELECT 1", Line: 1},
+			}))
+		})
+
+		It("keeps the BEGIN ... END body of a trigger in one statement", func() {
+			query := "CREATE TABLE a (id INT, n INT);\n" +
+				"CREATE TEMP TRIGGER a_insert AFTER INSERT ON a BEGIN\n" +
+				"  UPDATE a SET n = CASE WHEN new.id > 0 THEN 1 ELSE 0 END WHERE id = new.id;\n" +
+				"  INSERT INTO log VALUES ('begin; end');\n" +
+				"END;\n" +
+				"BEGIN; SELECT 1;"
+
+			statements, err := SplitStatements(query, sqlite)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statements).To(Equal([]Statement{
+				{SQL: "CREATE TABLE a (id INT, n INT)", Line: 1},
+				{SQL: "CREATE TEMP TRIGGER a_insert AFTER INSERT ON a BEGIN\n" +
+					"  UPDATE a SET n = CASE WHEN new.id > 0 THEN 1 ELSE 0 END WHERE id = new.id;\n" +
+					"  INSERT INTO log VALUES ('begin; end');\n" +
+					"END", Line: 2},
+				{SQL: "BEGIN", Line: 6},
+				{SQL: "SELECT 1", Line: 6},
+			}))
+		})
+
+		Context("with an unterminated quoted string", func() {
+			It("returns an error with the line it starts on", func() {
+				_, err := SplitStatements("SELECT 1;\nSELECT 'oops;", mysql)
+				Expect(err).To(MatchError("line 2: unterminated quoted string"))
+			})
+		})
+	})
+})
@@ -0,0 +1,838 @@
+package migration_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	// sqlite driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nicday/turtle/config"
+	"github.com/nicday/turtle/db"
+	. "github.com/nicday/turtle/migration"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// These specs run the migrations against a real SQLite database, rather than asserting on the SQL sent to sqlmock.
+var _ = Describe("migration with sqlite", func() {
+	var (
+		dir        string
+		conn       *sql.DB
+		previous   *sql.DB
+		previousFS FileSystem
+	)
+
+	sqliteFS := NewMockFS()
+	sqliteFS.AddFiles(
+		"",
+		NewMockFile("migrations", []byte(""),
+			NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER)")),
+			NewMockFile("20150703234300002_second_up.sql", []byte("CREATE TABLE second (id INTEGER)")),
+			NewMockFile("20150703234300003_third_up.sql", []byte("CREATE TABLE third (id INTEGER)")),
+			NewMockFile("20150703234300001_first_down.sql", []byte("DROP TABLE first")),
+			NewMockFile("20150703234300002_second_down.sql", []byte("DROP TABLE second")),
+			NewMockFile("20150703234300003_third_down.sql", []byte("DROP TABLE third")),
+		),
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "turtle")
+		Expect(err).NotTo(HaveOccurred())
+
+		config.DBDriver = "sqlite"
+		config.DBPath = path.Join(dir, "turtle.db")
+
+		conn, err = sql.Open("sqlite3", config.DBPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		previous = db.Conn
+		db.Conn = conn
+
+		previousFS = FS
+		FS = sqliteFS
+	})
+
+	AfterEach(func() {
+		db.Conn = previous
+		FS = previousFS
+		config.DBDriver = "mysql"
+		config.TransactionMode = config.TransactionPerMigration
+		config.OutOfOrder = config.OutOfOrderFail
+		conn.Close()
+		os.RemoveAll(dir)
+	})
+
+	tables := func() []string {
+		rows, err := conn.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+		Expect(err).NotTo(HaveOccurred())
+		defer rows.Close()
+
+		names := []string{}
+		for rows.Next() {
+			var name string
+			Expect(rows.Scan(&name)).To(Succeed())
+			names = append(names, name)
+		}
+		return names
+	}
+
+	Describe(".ApplyAll", func() {
+		It("creates the migrations table and applies all migrations", func() {
+			err := ApplyAll()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(tables()).To(Equal([]string{"first", "migrations", "migrations_lock", "second", "third"}))
+
+			active, err := db.MigrationActive("20150703234300003_third")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(active).To(BeTrue())
+		})
+	})
+
+	Describe("#PlanApplyAll", func() {
+		It("returns the pending migrations without creating the migrations table", func() {
+			steps, err := DefaultRunner().PlanApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(steps).To(HaveLen(3))
+			Expect(steps[0]).To(Equal(Step{
+				ID:        "20150703234300001_first",
+				Direction: "up",
+				Path:      "migrations/20150703234300001_first_up.sql",
+				SQL:       "CREATE TABLE first (id INTEGER)",
+			}))
+			Expect(tables()).To(BeEmpty())
+		})
+	})
+
+	Describe("#PlanRollback", func() {
+		It("returns the latest active migrations without reverting them", func() {
+			Expect(ApplyAll()).To(Succeed())
+
+			steps, err := DefaultRunner().PlanRollback(context.Background(), 2)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stepIDs(steps)).To(Equal([]string{"20150703234300003_third down", "20150703234300002_second down"}))
+			Expect(tables()).To(ContainElement("third"))
+		})
+	})
+
+	Describe("#PlanMigrateTo", func() {
+		It("returns the migrations to revert and apply", func() {
+			Expect(DefaultRunner().Log.CreateTable(context.Background())).To(Succeed())
+			Expect(db.InsertMigration("20150703234300003_third")).To(Succeed())
+
+			steps, err := DefaultRunner().PlanMigrateTo(context.Background(), "20150703234300002")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(stepIDs(steps)).To(Equal([]string{
+				"20150703234300003_third down",
+				"20150703234300001_first up",
+				"20150703234300002_second up",
+			}))
+		})
+	})
+
+	Describe("Go migrations", func() {
+		var runner *Runner
+
+		BeforeEach(func() {
+			runner = DefaultRunner()
+			runner.GoMigrations = map[string]*Migration{
+				"20150703234300004_backfill": {
+					ID: "20150703234300004_backfill",
+					Up: func(ctx context.Context, tx *sql.Tx) error {
+						_, err := tx.ExecContext(ctx, "INSERT INTO first (id) VALUES (1)")
+						return err
+					},
+					Down: func(ctx context.Context, tx *sql.Tx) error {
+						_, err := tx.ExecContext(ctx, "DELETE FROM first")
+						return err
+					},
+				},
+			}
+		})
+
+		count := func() int {
+			var n int
+			Expect(conn.QueryRow("SELECT COUNT(*) FROM first").Scan(&n)).To(Succeed())
+			return n
+		}
+
+		It("applies and reverts them in order with the migration files", func() {
+			results, err := runner.ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(4))
+			Expect(results[3].ID).To(Equal("20150703234300004_backfill"))
+			Expect(count()).To(Equal(1))
+
+			results, err = runner.Rollback(context.Background(), 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{{ID: "20150703234300004_backfill", Direction: "down"}}))
+			Expect(count()).To(Equal(0))
+		})
+
+		It("rolls back the migration when the function fails", func() {
+			runner.GoMigrations["20150703234300004_backfill"].Up = func(ctx context.Context, tx *sql.Tx) error {
+				tx.ExecContext(ctx, "INSERT INTO first (id) VALUES (1)")
+				return errors.New("backfill failed")
+			}
+
+			_, err := runner.ApplyAll(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("backfill failed")))
+			Expect(count()).To(Equal(0))
+		})
+
+		It("can't be reverted without a down function", func() {
+			runner.GoMigrations["20150703234300004_backfill"].Down = nil
+			_, err := runner.ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = runner.Rollback(context.Background(), 1)
+			Expect(err).To(MatchError(ContainSubstring(ErrIrreversible.Error())))
+		})
+
+		It("returns an error when a migration file has the same ID", func() {
+			runner.GoMigrations["20150703234300001_first"] = &Migration{
+				ID: "20150703234300001_first",
+				Up: func(ctx context.Context, tx *sql.Tx) error { return nil },
+			}
+
+			_, err := runner.Migrations()
+			Expect(err).To(MatchError(ContainSubstring(ErrDuplicateMigration.Error())))
+		})
+
+		It("returns an error when a migration file has the same version", func() {
+			runner.GoMigrations["020150703234300002_backfill"] = &Migration{
+				ID: "020150703234300002_backfill",
+				Up: func(ctx context.Context, tx *sql.Tx) error { return nil },
+			}
+
+			_, err := runner.ApplyAll(context.Background())
+			Expect(err).To(MatchError(ContainSubstring(
+				ErrDuplicateVersion.Error() + ": 020150703234300002_backfill and 20150703234300002_second",
+			)))
+			Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+		})
+	})
+
+	Context("when the migrations table was created by an earlier version", func() {
+		It("upgrades the table and records the new columns", func() {
+			_, err := conn.Exec("CREATE TABLE migrations (id INTEGER PRIMARY KEY AUTOINCREMENT, migration_id VARCHAR(255) NOT NULL UNIQUE)")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = conn.Exec("INSERT INTO migrations (migration_id) VALUES ('20150703234300001_first')")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ApplyAll()).To(Succeed())
+
+			records, err := db.DefaultLog().Applied(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(3))
+
+			Expect(records[0].ID).To(Equal("20150703234300001_first"))
+			Expect(records[0].AppliedAt.IsZero()).To(BeTrue())
+			Expect(records[0].Checksum).To(BeEmpty())
+
+			sum := sha256.Sum256([]byte("CREATE TABLE second (id INTEGER)"))
+			Expect(records[1].ID).To(Equal("20150703234300002_second"))
+			Expect(records[1].AppliedAt.IsZero()).To(BeFalse())
+			Expect(records[1].Checksum).To(Equal(hex.EncodeToString(sum[:])))
+			Expect(records[1].Version).To(Equal(config.Version))
+			Expect(records[1].AppliedBy).NotTo(BeEmpty())
+		})
+	})
+
+	Describe("schema", func() {
+		It("dumps the schema and loads it into a fresh database", func() {
+			Expect(ApplyAll()).To(Succeed())
+			_, err := conn.Exec("CREATE INDEX first_id ON first (id)")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = conn.Exec("CREATE TRIGGER first_insert AFTER INSERT ON first BEGIN INSERT INTO second VALUES (new.id); END")
+			Expect(err).NotTo(HaveOccurred())
+
+			var schema bytes.Buffer
+			Expect(DefaultRunner().DumpSchema(context.Background(), &schema)).To(Succeed())
+			Expect(schema.String()).To(ContainSubstring("CREATE TABLE first (id INTEGER);\n\nCREATE TABLE second"))
+			Expect(schema.String()).To(ContainSubstring("CREATE INDEX first_id ON first (id);"))
+			Expect(schema.String()).To(ContainSubstring("CREATE TRIGGER first_insert AFTER INSERT ON first BEGIN INSERT INTO second VALUES (new.id); END;"))
+			Expect(schema.String()).NotTo(ContainSubstring("migrations"))
+			Expect(schema.String()).To(HaveSuffix("-- turtle:applied 20150703234300003_third\n"))
+
+			dumped := conn
+			defer dumped.Close()
+			conn, err = sql.Open("sqlite3", path.Join(dir, "fresh.db"))
+			Expect(err).NotTo(HaveOccurred())
+			db.Conn = conn
+
+			results, err := DefaultRunner().LoadSchema(context.Background(), bytes.NewReader(schema.Bytes()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(3))
+
+			Expect(tables()).To(Equal([]string{"first", "migrations", "migrations_lock", "second", "third"}))
+			Expect(Validate()).To(Succeed())
+
+			_, err = conn.Exec("INSERT INTO first VALUES (1)")
+			Expect(err).NotTo(HaveOccurred())
+			var copied int
+			Expect(conn.QueryRow("SELECT id FROM second").Scan(&copied)).To(Succeed())
+			Expect(copied).To(Equal(1))
+
+			_, err = DefaultRunner().LoadSchema(context.Background(), bytes.NewReader(schema.Bytes()))
+			Expect(err).To(Equal(ErrDatabaseNotEmpty))
+		})
+	})
+
+	Context("with a pending migration older than the latest applied migration", func() {
+		BeforeEach(func() {
+			Expect(DefaultRunner().Log.CreateTable(context.Background())).To(Succeed())
+			Expect(db.InsertMigration("20150703234300001_first")).To(Succeed())
+			Expect(db.InsertMigration("20150703234300003_third")).To(Succeed())
+		})
+
+		It("fails without applying any migrations", func() {
+			_, err := DefaultRunner().ApplyAll(context.Background())
+			Expect(err).To(MatchError(ContainSubstring(ErrOutOfOrder.Error())))
+			Expect(err).To(MatchError(ContainSubstring("20150703234300002_second (latest applied 20150703234300003_third)")))
+
+			Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+		})
+
+		It("applies and flags the migration with OUT_OF_ORDER=warn", func() {
+			config.OutOfOrder = config.OutOfOrderWarn
+
+			results, err := DefaultRunner().ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{{ID: "20150703234300002_second", Direction: "up", OutOfOrder: true}}))
+			Expect(results[0].String()).To(Equal("Migration (20150703234300002_second) applied out of order"))
+		})
+
+		It("applies the migration with OUT_OF_ORDER=allow", func() {
+			config.OutOfOrder = config.OutOfOrderAllow
+
+			results, err := DefaultRunner().ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{{ID: "20150703234300002_second", Direction: "up"}}))
+		})
+
+		It("flags the migration in the status", func() {
+			var out bytes.Buffer
+			_, err := PrintStatus(&out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.String()).To(MatchRegexp(`20150703234300002_second\s+pending \(out of order\)\s+-`))
+		})
+	})
+
+	Describe("#Lint", func() {
+		It("reports problems with the migration files", func() {
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER)")),
+				NewMockFile("20150703234300002_second_up.sql", []byte("-- TODO\n")),
+				NewMockFile("20150703234300002_second_down.sql", []byte("DROP TABLE second")),
+				NewMockFile("20150703234300003_third.sql", []byte("-- +turtle Up\nCREATE TABLE third (id INTEGER)")),
+				NewMockFile("20150703234300003_other_up.sql", []byte("CREATE TABLE other (id INTEGER)")),
+				NewMockFile("20150703234300003_other_down.sql", []byte("DROP TABLE other")),
+				NewMockFile("20150703234300004_fourth_UP.sql", []byte("CREATE TABLE fourth (id INTEGER)")),
+				NewMockFile("20150703234300005-fifth_up.sql", []byte("CREATE TABLE fifth (id INTEGER)")),
+				NewMockFile("README.md", []byte("")),
+			))
+
+			issues, err := DefaultRunner().LintFiles()
+			Expect(err).NotTo(HaveOccurred())
+
+			messages := []string{}
+			for _, issue := range issues {
+				messages = append(messages, issue.String())
+			}
+			Expect(messages).To(Equal([]string{
+				"migrations/20150703234300004_fourth_UP.sql: is loaded as a single file migration, the _up and _down " +
+					"suffixes must be lowercase",
+				"migrations/20150703234300005-fifth_up.sql: doesn't match <id>_<name>_up.sql, <id>_<name>_down.sql or " +
+					"<id>_<name>.sql",
+				"20150703234300001_first: missing down file",
+				"migrations/20150703234300002_second_up.sql: up migration is empty",
+				"migrations/20150703234300003_third.sql: migration has no down migration",
+				"migrations/20150703234300004_fourth_UP.sql: line 1: SQL before the `-- +turtle Up` section",
+				"20150703234300003_other: version 20150703234300003 is used by more than one migration: " +
+					"20150703234300003_other, 20150703234300003_third",
+			}))
+		})
+
+		It("reports pending migrations older than the applied migrations", func() {
+			Expect(DefaultRunner().Log.CreateTable(context.Background())).To(Succeed())
+			Expect(db.InsertMigration("20150703234300002_second")).To(Succeed())
+
+			issues, err := DefaultRunner().Lint(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(issues).To(Equal([]LintIssue{{
+				ID:      "20150703234300001_first",
+				Message: "pending but older than the applied migration 20150703234300002_second",
+			}}))
+		})
+	})
+
+	Describe(".Validate", func() {
+		It("fails when an applied migration has changed until it's repaired", func() {
+			Expect(ApplyAll()).To(Succeed())
+
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER, name TEXT)")),
+				NewMockFile("20150703234300001_first_down.sql", []byte("DROP TABLE first")),
+			))
+
+			err := Validate()
+			Expect(err).To(BeAssignableToTypeOf(&ChecksumError{}))
+			Expect(err.(*ChecksumError).Mismatches).To(HaveLen(1))
+			Expect(ApplyAll()).NotTo(Succeed())
+
+			Expect(Repair()).To(Succeed())
+			Expect(Validate()).To(Succeed())
+		})
+	})
+
+	Context("when a statement fails", func() {
+		It("reports the statement and rolls back the migration", func() {
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER);\n\nINSERT INTO missing VALUES (1);")),
+			))
+
+			err := ApplyAll()
+			Expect(err).To(MatchError(ContainSubstring("statement 2 (line 3)")))
+
+			Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+		})
+	})
+
+	Context("with the turtle:no-transaction directive", func() {
+		It("runs the migration outside a transaction", func() {
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte("-- turtle:no-transaction\nCREATE TABLE first (id INTEGER);\nINSERT INTO missing VALUES (1);")),
+			))
+
+			err := ApplyAll()
+			Expect(err).To(MatchError(ContainSubstring("statement 2 (line 3)")))
+			Expect(err.(*Error).Unrecorded).To(BeTrue())
+
+			Expect(tables()).To(Equal([]string{"first", "migrations", "migrations_lock"}))
+		})
+	})
+
+	Context("with an unknown directive", func() {
+		It("doesn't apply any migrations", func() {
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER)")),
+				NewMockFile("20150703234300002_second_up.sql", []byte("-- turtle:no-transactions\nCREATE TABLE second (id INTEGER)")),
+			))
+
+			err := ApplyAll()
+			Expect(err).To(MatchError(ContainSubstring("unknown directive turtle:no-transactions")))
+
+			Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+		})
+	})
+
+	Context("with a migration without statements", func() {
+		It("fails without recording it", func() {
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_todo.sql", []byte("-- +turtle Up\n-- TODO\n\n-- +turtle Down\n")),
+			))
+
+			_, err := DefaultRunner().ApplyAll(context.Background())
+			Expect(err).To(MatchError(ContainSubstring(ErrEmptyMigration.Error())))
+
+			active, err := DefaultRunner().Log.Applied(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(active).To(BeEmpty())
+		})
+	})
+
+	Describe("scripts", func() {
+		It("runs a migration that ends with a comment separately from the migrations table insert", func() {
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER)\n-- the first table")),
+				NewMockFile("20150703234300002_second_up.sql", []byte("CREATE TABLE second (id INTEGER)")),
+			))
+
+			var script bytes.Buffer
+			Expect(DefaultRunner().Script(&script, "up", ScriptOptions{})).To(Succeed())
+			Expect(script.String()).To(ContainSubstring("-- the first table\n;\nINSERT INTO"))
+			Expect(script.String()).To(ContainSubstring("CREATE TABLE second (id INTEGER);\nINSERT INTO"))
+
+			_, err := conn.Exec(script.String())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tables()).To(Equal([]string{"first", "migrations", "second"}))
+			Expect(Validate()).To(Succeed())
+		})
+	})
+
+	Context("with single file migrations", func() {
+		files := func(extra ...MockFile) {
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""), append([]MockFile{
+				NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER)")),
+				NewMockFile("20150703234300001_first_down.sql", []byte("DROP TABLE first")),
+				NewMockFile("20150703234300002_second.sql", []byte(
+					"-- Creates the second table\n-- +turtle Up\nCREATE TABLE second (id INTEGER);\n\n-- +turtle Down\nDROP TABLE second;\n",
+				)),
+			}, extra...)...))
+		}
+
+		It("applies and reverts the sections alongside up and down files", func() {
+			files()
+
+			Expect(ApplyAll()).To(Succeed())
+			Expect(tables()).To(Equal([]string{"first", "migrations", "migrations_lock", "second"}))
+
+			Expect(Rollback(1)).To(Succeed())
+			Expect(tables()).To(Equal([]string{"first", "migrations", "migrations_lock"}))
+		})
+
+		It("doesn't change the up checksum when only the down section is edited", func() {
+			files()
+			Expect(ApplyAll()).To(Succeed())
+
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER)")),
+				NewMockFile("20150703234300001_first_down.sql", []byte("DROP TABLE first")),
+				NewMockFile("20150703234300002_second.sql", []byte(
+					"-- Creates the second table\n-- +turtle Up\nCREATE TABLE second (id INTEGER);\n\n-- +turtle Down\n"+
+						"-- Drops the second table\n\nDROP TABLE IF EXISTS second;\n",
+				)),
+			))
+			Expect(DefaultRunner().Validate(context.Background())).To(Succeed())
+		})
+
+		It("reports line numbers in the file", func() {
+			files(NewMockFile("20150703234300003_third.sql", []byte("-- +turtle Up\nCREATE TABLE third (id INTEGER);\nINSERT INTO missing VALUES (1);")))
+
+			err := ApplyAll()
+			Expect(err).To(MatchError(ContainSubstring("statement 2 (line 3)")))
+		})
+
+		It("can't revert a migration without a down section", func() {
+			files(NewMockFile("20150703234300003_third.sql", []byte("-- +turtle Up\nCREATE TABLE third (id INTEGER)")))
+			Expect(ApplyAll()).To(Succeed())
+
+			err := Rollback(1)
+			Expect(err).To(MatchError(ContainSubstring(ErrIrreversible.Error())))
+			Expect(tables()).To(ContainElement("third"))
+		})
+
+		It("doesn't apply any migrations when a file has no up section", func() {
+			files(NewMockFile("20150703234300003_third.sql", []byte("CREATE TABLE third (id INTEGER)")))
+
+			err := ApplyAll()
+			Expect(err).To(MatchError(ContainSubstring("line 1: SQL before the `-- +turtle Up` section")))
+			Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+		})
+
+		It("returns an error when up and down files have the same ID", func() {
+			files(NewMockFile("20150703234300002_second_up.sql", []byte("CREATE TABLE second (id INTEGER)")))
+
+			_, err := DefaultRunner().Migrations()
+			Expect(err).To(MatchError(ContainSubstring(ErrDuplicateMigration.Error())))
+		})
+	})
+
+	Context("with migrations in subdirectories", func() {
+		files := func(extra ...MockFile) {
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""), append([]MockFile{
+				NewMockFile("2015", []byte(""),
+					NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER)")),
+					NewMockFile("20150703234300001_first_down.sql", []byte("DROP TABLE first")),
+				),
+				NewMockFile("2016", []byte(""),
+					NewMockFile("20160101000000001_second.sql", []byte("-- +turtle Up\nCREATE TABLE second (id INTEGER)")),
+					NewMockFile(".drafts", []byte(""),
+						NewMockFile("20160101000000002_draft_up.sql", []byte("CREATE TABLE draft (id INTEGER)")),
+					),
+				),
+			}, extra...)...))
+		}
+
+		It("applies the migrations of all the subdirectories in order, skipping hidden directories", func() {
+			files(NewMockFile("20150703234300002_top_up.sql", []byte("CREATE TABLE top (id INTEGER)")))
+
+			results, err := DefaultRunner().ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{
+				{ID: "20150703234300001_first", Direction: "up"},
+				{ID: "20150703234300002_top", Direction: "up"},
+				{ID: "20160101000000001_second", Direction: "up"},
+			}))
+		})
+
+		It("returns an error when a migration is in more than one directory", func() {
+			files(NewMockFile("2016-copy", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER)")),
+			))
+
+			_, err := DefaultRunner().Migrations()
+			Expect(err).To(MatchError(ContainSubstring(ErrDuplicateMigration.Error())))
+			Expect(err).To(MatchError(ContainSubstring(
+				"20150703234300001_first is in both migrations/2015 and migrations/2016-copy",
+			)))
+		})
+
+		It("lints the files in the subdirectories", func() {
+			files(NewMockFile("2017", []byte(""), NewMockFile("20170101000000001_third.SQL", []byte(""))))
+
+			issues, err := DefaultRunner().LintFiles()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(issues).To(ContainElement(LintIssue{
+				Path:    "migrations/2017/20170101000000001_third.SQL",
+				Message: "doesn't match <id>_<name>_up.sql, <id>_<name>_down.sql or <id>_<name>.sql",
+			}))
+		})
+	})
+
+	Describe("migration sets", func() {
+		var sets Sets
+
+		BeforeEach(func() {
+			fs := NewMockFS()
+			fs.AddFiles("", NewMockFile("core", []byte(""),
+				NewMockFile("20150703234300001_accounts_up.sql", []byte("CREATE TABLE accounts (id INTEGER)")),
+				NewMockFile("20150703234300001_accounts_down.sql", []byte("DROP TABLE accounts")),
+				NewMockFile("20150703234300003_users_up.sql", []byte("CREATE TABLE users (account_id INTEGER)")),
+				NewMockFile("20150703234300003_users_down.sql", []byte("DROP TABLE users")),
+			))
+			fs.AddFiles("", NewMockFile("billing", []byte(""),
+				NewMockFile("20150703234300002_invoices_up.sql", []byte("CREATE TABLE invoices (account_id INTEGER)")),
+				NewMockFile("20150703234300002_invoices_down.sql", []byte("DROP TABLE invoices")),
+			))
+			FS = fs
+
+			sets = NewSets([]config.MigrationSet{
+				{Name: "core", Path: "core", Table: "migrations_core"},
+				{Name: "billing", Path: "billing", Table: "migrations_billing"},
+			})
+		})
+
+		It("records each set in its own migrations table", func() {
+			_, err := sets[1].Runner.ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(tables()).To(Equal([]string{"invoices", "migrations_billing", "migrations_billing_lock"}))
+		})
+
+		It("applies the migrations of all the sets in order by ID", func() {
+			results, err := sets.ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{
+				{ID: "20150703234300001_accounts", Direction: "up", Set: "core"},
+				{ID: "20150703234300002_invoices", Direction: "up", Set: "billing"},
+				{ID: "20150703234300003_users", Direction: "up", Set: "core"},
+			}))
+			Expect(results[1].String()).To(Equal("Migration (billing/20150703234300002_invoices) applied"))
+
+			Expect(tables()).To(Equal([]string{
+				"accounts", "invoices", "migrations_billing", "migrations_billing_lock", "migrations_core",
+				"migrations_core_lock", "users",
+			}))
+		})
+
+		It("reverts the migrations of all the sets in reverse order by ID", func() {
+			_, err := sets.ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err := sets.RevertAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{
+				{ID: "20150703234300003_users", Direction: "down", Set: "core"},
+				{ID: "20150703234300002_invoices", Direction: "down", Set: "billing"},
+				{ID: "20150703234300001_accounts", Direction: "down", Set: "core"},
+			}))
+
+			Expect(tables()).To(Equal([]string{
+				"migrations_billing", "migrations_billing_lock", "migrations_core", "migrations_core_lock",
+			}))
+		})
+
+		It("runs the Go migrations of each set only in that set", func() {
+			RegisterSet("audit", "20150703234300004_audit", func(ctx context.Context, tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "CREATE TABLE audit (id INTEGER)")
+				return err
+			}, nil)
+			sets = NewSets([]config.MigrationSet{
+				{Name: "core", Path: "core", Table: "migrations_core"},
+				{Name: "audit", Path: "billing", Table: "migrations_audit"},
+			})
+			Expect(sets[0].Runner.GoMigrations).To(BeEmpty())
+
+			results, err := sets.ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(4))
+			Expect(results[3]).To(Equal(Result{ID: "20150703234300004_audit", Direction: "up", Set: "audit"}))
+			Expect(tables()).To(ContainElement("audit"))
+		})
+
+		Context("with all the migrations in one transaction", func() {
+			failing := func(invoices string) {
+				fs := NewMockFS()
+				fs.AddFiles("", NewMockFile("core", []byte(""),
+					NewMockFile("20150703234300001_accounts_up.sql", []byte("CREATE TABLE accounts (id INTEGER)")),
+					NewMockFile("20150703234300003_users_up.sql", []byte("INSERT INTO missing VALUES (1)")),
+				))
+				fs.AddFiles("", NewMockFile("billing", []byte(""),
+					NewMockFile("20150703234300002_invoices_up.sql", []byte(invoices)),
+				))
+				for _, set := range sets {
+					set.Runner.FS = fs
+				}
+			}
+
+			It("rolls back the migrations of every set when one fails with TRANSACTION_MODE=all", func() {
+				failing("CREATE TABLE invoices (account_id INTEGER)")
+				sets[1].Runner.TransactionMode = config.TransactionAll
+
+				results, err := sets.ApplyAll(context.Background())
+				Expect(err).To(HaveOccurred())
+				Expect(err.(*Error).ID).To(Equal("20150703234300003_users"))
+				Expect(results).To(BeEmpty())
+
+				Expect(tables()).To(Equal([]string{
+					"migrations_billing", "migrations_billing_lock", "migrations_core", "migrations_core_lock",
+				}))
+			})
+
+			It("rolls back the migrations of every set when one fails with the turtle:transaction all directive", func() {
+				failing("-- turtle:transaction all\nCREATE TABLE invoices (account_id INTEGER)")
+
+				_, err := sets.ApplyAll(context.Background())
+				Expect(err).To(HaveOccurred())
+
+				Expect(tables()).To(Equal([]string{
+					"migrations_billing", "migrations_billing_lock", "migrations_core", "migrations_core_lock",
+				}))
+			})
+		})
+
+		It("checks the order of each set on its own", func() {
+			_, err := sets[0].Runner.ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err := sets.ApplyAll(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{{ID: "20150703234300002_invoices", Direction: "up", Set: "billing"}}))
+		})
+	})
+
+	Describe("applying all pending migrations in one transaction", func() {
+		failing := func(first string) FileSystem {
+			fs := NewMockFS()
+			fs.AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte(first)),
+				NewMockFile("20150703234300002_second_up.sql", []byte("CREATE TABLE second (id INTEGER)")),
+				NewMockFile("20150703234300003_third_up.sql", []byte("INSERT INTO missing VALUES (1)")),
+			))
+			return fs
+		}
+
+		Context("with TRANSACTION_MODE=all", func() {
+			It("rolls back every migration when one fails", func() {
+				config.TransactionMode = config.TransactionAll
+				FS = failing("CREATE TABLE first (id INTEGER)")
+
+				err := ApplyAll()
+				Expect(err).To(HaveOccurred())
+				Expect(err.(*Error).ID).To(Equal("20150703234300003_third"))
+
+				Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+			})
+
+			It("applies every migration", func() {
+				config.TransactionMode = config.TransactionAll
+
+				Expect(ApplyAll()).To(Succeed())
+
+				Expect(tables()).To(Equal([]string{"first", "migrations", "migrations_lock", "second", "third"}))
+			})
+		})
+
+		Context("with the turtle:transaction all directive", func() {
+			It("rolls back every migration when one fails", func() {
+				FS = failing("-- turtle:transaction all\nCREATE TABLE first (id INTEGER)")
+
+				Expect(ApplyAll()).NotTo(Succeed())
+
+				Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+			})
+		})
+
+		Context("with a turtle:no-transaction migration", func() {
+			It("doesn't apply any migrations", func() {
+				config.TransactionMode = config.TransactionAll
+				FS = failing("-- turtle:no-transaction\nCREATE TABLE first (id INTEGER)")
+
+				err := ApplyAll()
+				Expect(err).To(MatchError(ContainSubstring(ErrNoTransactionInBatch.Error())))
+
+				Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+			})
+		})
+	})
+
+	Context("when the migration log can't be updated", func() {
+		It("rolls back the migration with the log update", func() {
+			FS = NewMockFS()
+			FS.(*MockFS).AddFiles("", NewMockFile("migrations", []byte(""),
+				NewMockFile("20150703234300001_first_up.sql", []byte("CREATE TABLE first (id INTEGER); DROP TABLE migrations")),
+			))
+
+			err := ApplyAll()
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*Error).Unrecorded).To(BeFalse())
+
+			Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+		})
+	})
+
+	Describe(".Rollback(n)", func() {
+		It("reverts the latest migrations", func() {
+			Expect(ApplyAll()).To(Succeed())
+
+			err := Rollback(2)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(tables()).To(Equal([]string{"first", "migrations", "migrations_lock"}))
+		})
+	})
+
+	Describe(".RevertAll", func() {
+		It("reverts all migrations", func() {
+			Expect(ApplyAll()).To(Succeed())
+
+			err := RevertAll()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(tables()).To(Equal([]string{"migrations", "migrations_lock"}))
+		})
+	})
+})
+
+// stepIDs returns the ID and direction of each step.
+func stepIDs(steps []Step) []string {
+	ids := []string{}
+	for _, s := range steps {
+		ids = append(ids, s.ID+" "+s.Direction)
+	}
+	return ids
+}
@@ -0,0 +1,137 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nicday/turtle/db"
+)
+
+// State is the state of a migration in the database.
+type State string
+
+const (
+	// StatePending is a migration that hasn't been applied.
+	StatePending State = "pending"
+
+	// StateApplied is a migration that has been applied.
+	StateApplied State = "applied"
+
+	// StateMissing is a migration that has been applied, but its files are no longer present.
+	StateMissing State = "missing"
+)
+
+// Status is the state of a single migration.
+type Status struct {
+	ID    string
+	State State
+
+	// AppliedAt is when the migration was applied, it is zero for pending migrations and migrations logged before the
+	// migrations table recorded it.
+	AppliedAt time.Time
+
+	// OutOfOrder is true for a pending migration that is older than the latest applied migration.
+	OutOfOrder bool
+}
+
+// Summary is the number of migrations in each state.
+type Summary map[State]int
+
+// String returns a description of the summary.
+func (s Summary) String() string {
+	return fmt.Sprintf("%d applied, %d pending, %d missing", s[StateApplied], s[StatePending], s[StateMissing])
+}
+
+// Summarize counts the migrations in each state.
+func Summarize(statuses []Status) Summary {
+	s := Summary{}
+	for _, status := range statuses {
+		s[status.State]++
+	}
+	return s
+}
+
+// Status returns the state of every migration, either found in the migration directory or in the migration log, in
+// chronological order. The migrations table isn't created if it's missing.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	statuses := []Status{}
+
+	migrations, err := r.Migrations()
+	if err != nil {
+		return statuses, err
+	}
+
+	present, err := r.Log.TablePresent(ctx)
+	if err != nil {
+		return statuses, err
+	}
+
+	applied := map[string]db.Record{}
+	if present {
+		records, err := r.Log.Applied(ctx)
+		if err != nil {
+			return statuses, err
+		}
+		for _, record := range records {
+			applied[record.ID] = record
+			if _, ok := migrations[record.ID]; !ok {
+				migrations[record.ID] = &Migration{ID: record.ID}
+			}
+		}
+	}
+
+	sorted := SortMigrations(migrations, "asc")
+	late, _ := outOfOrder(sorted, func(m *Migration) bool {
+		_, ok := applied[m.ID]
+		return ok
+	})
+	isLate := map[string]bool{}
+	for _, m := range late {
+		isLate[m.ID] = true
+	}
+
+	for _, m := range sorted {
+		s := Status{ID: m.ID, State: StatePending, OutOfOrder: isLate[m.ID]}
+		if record, ok := applied[m.ID]; ok {
+			s.State = StateApplied
+			s.AppliedAt = record.AppliedAt
+			if m.UpPath == "" && m.DownPath == "" && !m.isGo() {
+				s.State = StateMissing
+			}
+		}
+		statuses = append(statuses, s)
+	}
+
+	return statuses, nil
+}
+
+// PrintStatus prints the state of every migration, followed by a summary. The summary is returned so that callers can
+// act on pending migrations.
+func PrintStatus(w io.Writer) (Summary, error) {
+	statuses, err := DefaultRunner().Status(context.Background())
+	if err != nil {
+		return Summary{}, err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, s := range statuses {
+		appliedAt := "-"
+		if !s.AppliedAt.IsZero() {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		state := string(s.State)
+		if s.OutOfOrder {
+			state += " (out of order)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.ID, state, appliedAt)
+	}
+	tw.Flush()
+
+	summary := Summarize(statuses)
+	fmt.Fprintln(w, summary)
+
+	return summary, nil
+}
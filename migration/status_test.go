@@ -0,0 +1,60 @@
+package migration_test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/nicday/turtle/config"
+	. "github.com/nicday/turtle/migration"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v0"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("status", func() {
+	Describe(".Summarize", func() {
+		It("counts the migrations in each state", func() {
+			summary := Summarize([]Status{
+				{ID: "1_first", State: StateApplied},
+				{ID: "2_second", State: StateMissing},
+				{ID: "3_third", State: StatePending},
+				{ID: "4_fourth", State: StatePending},
+			})
+
+			Expect(summary[StatePending]).To(Equal(2))
+			Expect(summary.String()).To(Equal("1 applied, 2 pending, 1 missing"))
+		})
+	})
+
+	Describe(".PrintStatus", func() {
+		It("prints the state of each migration and a summary", func() {
+			expectMigrationsTablePresenceQuery()
+			expectMigrationsTableColumnsQuery()
+			expectedSQL := fmt.Sprintf(
+				"SELECT migration_id, applied_at, checksum, duration_ms, turtle_version, applied_by FROM `%s` ORDER BY id",
+				config.MigrationsTableName,
+			)
+			sqlmock.ExpectQuery(regexp.QuoteMeta(expectedSQL)).
+				WillReturnRows(sqlmock.NewRows([]string{
+					"migration_id", "applied_at", "checksum", "duration_ms", "turtle_version", "applied_by",
+				}).
+					AddRow("20150703234300001_first", time.Date(2015, 7, 4, 9, 30, 0, 0, time.UTC), nil, nil, nil, nil).
+					AddRow("20150703234300000_removed", time.Date(2015, 7, 4, 9, 30, 0, 0, time.UTC), nil, nil, nil, nil))
+
+			out := &bytes.Buffer{}
+			summary, err := PrintStatus(out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(summary[StatePending]).To(Equal(2))
+			Expect(out.String()).To(Equal(
+				"20150703234300000_removed  missing  2015-07-04 09:30:00\n" +
+					"20150703234300001_first    applied  2015-07-04 09:30:00\n" +
+					"20150703234300002_second   pending  -\n" +
+					"20150703234300003_third    pending  -\n" +
+					"1 applied, 2 pending, 1 missing\n",
+			))
+		})
+	})
+})
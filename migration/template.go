@@ -0,0 +1,175 @@
+package migration
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/nicday/turtle/config"
+)
+
+var (
+	// ErrUnknownTemplate is raised when there is no template in the template directory or built in with the name.
+	ErrUnknownTemplate = errors.New("unknown template")
+
+	// ErrNoTemplateTable is raised when a built in template is used without a table.
+	ErrNoTemplateTable = errors.New("the template requires a table, e.g. `--table users`")
+
+	// ErrNoTemplateColumns is raised when a built in template that changes columns is used without any.
+	ErrNoTemplateColumns = errors.New("the template requires a column, e.g. `--column email:varchar(255)`")
+)
+
+// migrationTemplate is the text/template source of the up and down SQL of a migration.
+type migrationTemplate struct {
+	up   string
+	down string
+
+	// columns is true if the template requires at least one column.
+	columns bool
+}
+
+// builtinTemplates are the templates available without a template directory. Their SQL is valid for each dialect.
+var builtinTemplates = map[string]migrationTemplate{
+	"create_table": {
+		up: `CREATE TABLE {{.Table}} (
+  {{if eq .Dialect "postgres"}}id SERIAL PRIMARY KEY{{else if eq .Dialect "sqlite"}}id INTEGER PRIMARY KEY AUTOINCREMENT{{else}}id INT AUTO_INCREMENT PRIMARY KEY{{end}}
+{{- range .Columns}},
+  {{.Name}} {{.Type}}
+{{- end}}
+);
+`,
+		down: "DROP TABLE {{.Table}};\n",
+	},
+	"add_column": {
+		up:      "{{range .Columns}}ALTER TABLE {{$.Table}} ADD COLUMN {{.Name}} {{.Type}};\n{{end}}",
+		down:    "{{range .Columns}}ALTER TABLE {{$.Table}} DROP COLUMN {{.Name}};\n{{end}}",
+		columns: true,
+	},
+	"add_index": {
+		up:      "CREATE INDEX {{.IndexName}} ON {{.Table}} ({{join .ColumnNames \", \"}});\n",
+		down:    "DROP INDEX {{.IndexName}}{{if eq .Dialect \"mysql\"}} ON {{.Table}}{{end}};\n",
+		columns: true,
+	},
+}
+
+// TemplateData is the data a migration template is rendered with.
+type TemplateData struct {
+	// Name is the migration name given to generate.
+	Name string
+
+	// Timestamp is the ID prefix of the generated migration.
+	Timestamp string
+
+	// Dialect is the configured DB_DRIVER.
+	Dialect string
+
+	// Table and Columns are given with `--table` and `--column`.
+	Table   string
+	Columns []Column
+}
+
+// Column is a column given to generate as `name:type`. The type is empty if it was omitted, e.g. for an index.
+type Column struct {
+	Name string
+	Type string
+}
+
+// ParseColumn parses a `name:type` column, such as `email:varchar(255)`.
+func ParseColumn(s string) Column {
+	parts := strings.SplitN(s, ":", 2)
+	c := Column{Name: parts[0]}
+	if len(parts) > 1 {
+		c.Type = parts[1]
+	}
+	return c
+}
+
+// ColumnNames returns the names of the columns.
+func (d TemplateData) ColumnNames() []string {
+	names := []string{}
+	for _, c := range d.Columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// IndexName returns a name for an index on the table's columns, e.g. `users_email_idx`.
+func (d TemplateData) IndexName() string {
+	return fmt.Sprintf("%s_%s_idx", d.Table, strings.Join(d.ColumnNames(), "_"))
+}
+
+// renderTemplate renders the up and down SQL of the named template. A template in the template directory, made up of
+// `<name>_up.sql.tmpl` and an optional `<name>_down.sql.tmpl`, takes precedence over a built in template.
+func renderTemplate(name string, data TemplateData) (string, string, error) {
+	t, ok, err := loadTemplate(name)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		builtin, ok := builtinTemplates[name]
+		if !ok {
+			return "", "", fmt.Errorf("%v: %s", ErrUnknownTemplate, name)
+		}
+		if data.Table == "" {
+			return "", "", ErrNoTemplateTable
+		}
+		if builtin.columns && len(data.Columns) == 0 {
+			return "", "", ErrNoTemplateColumns
+		}
+		t = builtin
+	}
+
+	up, err := execTemplate(name+"_up", t.up, data)
+	if err != nil {
+		return "", "", err
+	}
+	down, err := execTemplate(name+"_down", t.down, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return up, down, nil
+}
+
+// loadTemplate reads the named template from the template directory, returning false if it isn't there.
+func loadTemplate(name string) (migrationTemplate, bool, error) {
+	t := migrationTemplate{}
+
+	up, err := ioutil.ReadFile(path.Join(config.TemplatesPath, name+"_up.sql.tmpl"))
+	if os.IsNotExist(err) {
+		return t, false, nil
+	}
+	if err != nil {
+		return t, false, err
+	}
+	t.up = string(up)
+
+	down, err := ioutil.ReadFile(path.Join(config.TemplatesPath, name+"_down.sql.tmpl"))
+	if err != nil && !os.IsNotExist(err) {
+		return t, false, err
+	}
+	t.down = string(down)
+
+	return t, true, nil
+}
+
+// execTemplate parses and renders a template.
+func execTemplate(name string, text string, data TemplateData) (string, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	err = t.Execute(&b, data)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
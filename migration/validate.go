@@ -0,0 +1,170 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ErrChecksumMismatch is raised when an applied migration's up file has changed since it was applied.
+var ErrChecksumMismatch = errors.New("migration changed since it was applied")
+
+// Mismatch is an applied migration whose up file no longer matches the checksum recorded when it was applied.
+type Mismatch struct {
+	ID string
+
+	// Recorded is the checksum in the migration log. It's empty for migrations applied before checksums were recorded.
+	Recorded string
+
+	// Current is the checksum of the up file in the migration directory.
+	Current string
+}
+
+// ChecksumError is returned when applied migrations have changed since they were applied.
+type ChecksumError struct {
+	Mismatches []Mismatch
+}
+
+// Error satisfies the error interface.
+func (e *ChecksumError) Error() string {
+	ids := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		ids[i] = m.ID
+	}
+	return fmt.Sprintf(
+		"%v: %s; repair the migration log to accept the changes",
+		ErrChecksumMismatch,
+		strings.Join(ids, ", "),
+	)
+}
+
+// Validate checks that the up files of the applied migrations match the checksums recorded when they were applied. A
+// *ChecksumError listing the changed migrations is returned if they don't. Migrations applied before checksums were
+// recorded, and those missing from the migration directory, aren't checked. The migrations table isn't created if it's
+// missing.
+func (r *Runner) Validate(ctx context.Context) error {
+	present, err := r.Log.TablePresent(ctx)
+	if err != nil || !present {
+		return err
+	}
+
+	return r.validate(ctx)
+}
+
+// Repair updates the recorded checksums of the applied migrations to match their up files, accepting any changes made
+// since they were applied. Checksums are also recorded for migrations applied before checksums were. The updated
+// migrations are returned.
+func (r *Runner) Repair(ctx context.Context) ([]Mismatch, error) {
+	repaired := []Mismatch{}
+
+	_, err := r.locked(ctx, func(ctx context.Context) ([]Result, error) {
+		err := r.assertTable(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		mismatches, err := r.mismatches(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range mismatches {
+			err := r.Log.UpdateChecksum(ctx, m.ID, m.Current)
+			if err != nil {
+				return nil, err
+			}
+			repaired = append(repaired, m)
+		}
+
+		return nil, nil
+	})
+
+	return repaired, err
+}
+
+// Validate checks that the applied migrations haven't changed since they were applied, printing any that have.
+func Validate() error {
+	err := DefaultRunner().Validate(context.Background())
+	if e, ok := err.(*ChecksumError); ok {
+		for _, m := range e.Mismatches {
+			fmt.Printf("Migration (%s) changed since it was applied\n", m.ID)
+		}
+	}
+	if err != nil {
+		log.Printf("[Error] %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Repair accepts changes to the applied migrations by updating their recorded checksums.
+func Repair() error {
+	repaired, err := DefaultRunner().Repair(context.Background())
+	for _, m := range repaired {
+		fmt.Printf("Migration (%s) checksum updated\n", m.ID)
+	}
+	if err != nil {
+		log.Printf("[Error] %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// validate returns a *ChecksumError if any applied migrations with a recorded checksum have changed.
+func (r *Runner) validate(ctx context.Context) error {
+	mismatches, err := r.mismatches(ctx)
+	if err != nil {
+		return err
+	}
+
+	changed := []Mismatch{}
+	for _, m := range mismatches {
+		if m.Recorded != "" {
+			changed = append(changed, m)
+		}
+	}
+	if len(changed) > 0 {
+		return &ChecksumError{Mismatches: changed}
+	}
+
+	return nil
+}
+
+// mismatches returns the applied migrations in the migration directory whose up SQL doesn't match the recorded
+// checksum, including those without a recorded checksum.
+func (r *Runner) mismatches(ctx context.Context) ([]Mismatch, error) {
+	mismatches := []Mismatch{}
+
+	records, err := r.Log.Applied(ctx)
+	if err != nil {
+		return mismatches, err
+	}
+
+	migrations, err := r.Migrations()
+	if err != nil {
+		return mismatches, err
+	}
+
+	for _, record := range records {
+		m, ok := migrations[record.ID]
+		if !ok || m.UpPath == "" {
+			continue
+		}
+
+		query, err := r.source(m, "up")
+		if err != nil {
+			return mismatches, err
+		}
+
+		current := upChecksum(m.UpPath, query)
+		if current != record.Checksum {
+			mismatches = append(mismatches, Mismatch{ID: record.ID, Recorded: record.Checksum, Current: current})
+		}
+	}
+
+	return mismatches, nil
+}
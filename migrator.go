@@ -1,92 +1,260 @@
-package main
+// Package turtle applies and reverts SQL migrations from within Go. See the turtle command for use from the shell.
+package turtle
 
 import (
-	"fmt"
-	"log"
-	"os"
-	"strconv"
+	"context"
+	"database/sql"
+	"io"
+	"io/fs"
+	"time"
 
-	"github.com/codegangsta/cli"
+	"github.com/nicday/turtle/config"
 	"github.com/nicday/turtle/db"
 	"github.com/nicday/turtle/migration"
 )
 
-func main() {
-	app := cli.NewApp()
-	app.Name = "turtle"
-	app.Usage = "for incredible (SQL) migrations, just the sea turtle!"
-	app.Version = "0.0.1"
-
-	app.Commands = []cli.Command{
-		cli.Command{
-			Name:    "generate",
-			Aliases: []string{"g"},
-			Usage:   "Generates a new set of migration files",
-			Action: func(c *cli.Context) {
-				if len(c.Args()) == 0 {
-					fmt.Println("Please call with a migration name, e.g. `turtle generate users`")
-					return
-				}
-				if len(c.Args()) != 0 {
-					migrationName := c.Args()[0]
-					migration.Generate(migrationName)
-				}
-			},
-		},
-		cli.Command{
-			Name:    "create",
-			Aliases: []string{"c"},
-			Usage:   "Creates the database on the host",
-			Action: func(c *cli.Context) {
-				migration.CreateDB()
-			},
-		},
-		cli.Command{
-			Name:    "drop",
-			Aliases: []string{"c"},
-			Usage:   "Drops the database on the host",
-			Action: func(c *cli.Context) {
-				migration.DropDB()
-			},
-		},
-		cli.Command{
-			Name:    "up",
-			Aliases: []string{"u"},
-			Usage:   "Processes all outstanding migrations",
-			Action: func(c *cli.Context) {
-				db.UseDB()
-				migration.ApplyAll()
-			},
-		},
-		cli.Command{
-			Name:    "down",
-			Aliases: []string{"d"},
-			Usage:   "Reverts all applied migrations",
-			Action: func(c *cli.Context) {
-				db.UseDB()
-				migration.RevertAll()
-			},
-		},
-		cli.Command{
-			Name:    "rollback",
-			Aliases: []string{"r"},
-			Usage:   "Rollback n active migrations",
-			Action: func(c *cli.Context) {
-				if len(c.Args()) == 0 {
-					fmt.Println("Please call with a number of migrations to rollback, e.g. `turtle rollback 3`")
-					return
-				}
-				if len(c.Args()) != 0 {
-					n, err := strconv.Atoi(c.Args()[0])
-					if err != nil {
-						log.Fatal("[Error] Rollback parameter is not an integer")
-					}
-					db.UseDB()
-					migration.Rollback(n)
-				}
-			},
-		},
+// Version is the version of turtle, which is recorded with each applied migration.
+const Version = config.Version
+
+const (
+	defaultDialect   = "mysql"
+	defaultTableName = "migrations"
+	defaultPath      = "migrations"
+
+	defaultLockTimeout = time.Minute
+)
+
+type (
+	// FileSystem is the source of the migration files.
+	FileSystem = migration.FileSystem
+
+	// GoFunc is the up or down function of a migration written in Go.
+	GoFunc = migration.GoFunc
+
+	// Result is a migration that was applied or reverted.
+	Result = migration.Result
+
+	// Status is the state of a single migration.
+	Status = migration.Status
+
+	// Step is a migration that a run would apply or revert, with its SQL.
+	Step = migration.Step
+
+	// ScriptOptions selects the migrations included in a script.
+	ScriptOptions = migration.ScriptOptions
+
+	// Mismatch is an applied migration that has changed since it was applied.
+	Mismatch = migration.Mismatch
+
+	// LintIssue is a problem with a migration found by Lint.
+	LintIssue = migration.LintIssue
+)
+
+// FromFS returns a FileSystem backed by an io/fs.FS, such as an embed.FS, for passing to New. This lets migrations be
+// embedded into the binary with `//go:embed`.
+func FromFS(fsys fs.FS) FileSystem {
+	return migration.FromFS(fsys)
+}
+
+// Register adds a migration written in Go, which is run by every Migrator along with the migration files and recorded
+// in the same migrations table. The ID follows the file naming, `<version>_<name>`, and orders it with the files. The
+// functions run in the migration's transaction; down may be nil if the migration can't be reverted. Register is
+// intended to be called from init functions, it panics if the ID is invalid or registered twice.
+func Register(id string, up, down GoFunc) {
+	migration.Register(id, up, down)
+}
+
+// Migrator applies and reverts migrations on a database. Unlike the turtle command it doesn't read the environment or
+// use package state, so several migrators, e.g. one for each schema, can be used in one process.
+//
+// Up, Down, Rollback and MigrateTo hold a migration lock while they run, so that concurrent deployments can't migrate
+// the database simultaneously. db.ErrLockTimeout is returned if the lock can't be acquired.
+type Migrator struct {
+	runner *migration.Runner
+}
+
+// Option configures a Migrator.
+type Option func(*options)
+
+type options struct {
+	dialect     string
+	tableName   string
+	path        string
+	lockTimeout time.Duration
+
+	transactionMode string
+	outOfOrder      string
+}
+
+// WithDialect sets the dialect, by its DB_DRIVER name, used to build SQL for the database. Defaults to `mysql`.
+func WithDialect(name string) Option {
+	return func(o *options) {
+		o.dialect = name
+	}
+}
+
+// WithTableName sets the table where migrations are logged in the database. Defaults to `migrations`.
+func WithTableName(name string) Option {
+	return func(o *options) {
+		o.tableName = name
+	}
+}
+
+// WithPath sets the location of the migration files in the FileSystem. Defaults to `migrations`.
+func WithPath(path string) Option {
+	return func(o *options) {
+		o.path = path
+	}
+}
+
+// WithLockTimeout sets how long to wait for another process to release the migration lock. Defaults to a minute.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.lockTimeout = timeout
+	}
+}
+
+// WithTransactionMode sets how migrations are grouped into transactions by Up and MigrateTo, either
+// config.TransactionPerMigration or config.TransactionAll. Defaults to a transaction per migration.
+func WithTransactionMode(mode string) Option {
+	return func(o *options) {
+		o.transactionMode = mode
+	}
+}
+
+// WithOutOfOrder sets the policy for pending migrations older than the latest applied migration, either
+// config.OutOfOrderFail, config.OutOfOrderWarn or config.OutOfOrderAllow. Defaults to failing.
+func WithOutOfOrder(policy string) Option {
+	return func(o *options) {
+		o.outOfOrder = policy
+	}
+}
+
+// New initializes a new Migrator for the database connection, loading migrations from fs. The connection must already
+// be bound to the database being migrated. A nil fs uses the operating system's file system.
+func New(conn *sql.DB, fs FileSystem, opts ...Option) (*Migrator, error) {
+	o := options{
+		dialect:         defaultDialect,
+		tableName:       defaultTableName,
+		path:            defaultPath,
+		lockTimeout:     defaultLockTimeout,
+		transactionMode: config.TransactionPerMigration,
+		outOfOrder:      config.OutOfOrderFail,
+	}
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	app.Run(os.Args)
+	dialect, err := db.LookupDialect(o.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.transactionMode != config.TransactionPerMigration && o.transactionMode != config.TransactionAll {
+		return nil, config.ErrInvalidTransactionMode
+	}
+
+	switch o.outOfOrder {
+	case config.OutOfOrderFail, config.OutOfOrderWarn, config.OutOfOrderAllow:
+	default:
+		return nil, config.ErrInvalidOutOfOrder
+	}
+
+	if fs == nil {
+		fs = migration.OS
+	}
+
+	runner := migration.NewRunner(fs, o.path, db.NewLog(conn, dialect, o.tableName))
+	runner.LockTimeout = o.lockTimeout
+	runner.TransactionMode = o.transactionMode
+	runner.OutOfOrder = o.outOfOrder
+
+	return &Migrator{runner: runner}, nil
+}
+
+// Up applies all pending migrations in chronological order.
+func (m *Migrator) Up(ctx context.Context) ([]Result, error) {
+	return m.runner.ApplyAll(ctx)
+}
+
+// Down reverts all applied migrations in reverse chronological order.
+func (m *Migrator) Down(ctx context.Context) ([]Result, error) {
+	return m.runner.RevertAll(ctx)
+}
+
+// Rollback reverts the latest `n` applied migrations.
+func (m *Migrator) Rollback(ctx context.Context, n int) ([]Result, error) {
+	return m.runner.Rollback(ctx, n)
+}
+
+// MigrateTo applies pending migrations up to and including the target migration, and reverts applied migrations newer
+// than it. The target is either a migration ID or its numeric version.
+func (m *Migrator) MigrateTo(ctx context.Context, target string) ([]Result, error) {
+	return m.runner.MigrateTo(ctx, target)
+}
+
+// PlanUp returns the migrations Up would apply, with their SQL, without changing the database.
+func (m *Migrator) PlanUp(ctx context.Context) ([]Step, error) {
+	return m.runner.PlanApplyAll(ctx)
+}
+
+// PlanDown returns the migrations Down would revert, with their SQL, without changing the database.
+func (m *Migrator) PlanDown(ctx context.Context) ([]Step, error) {
+	return m.runner.PlanRevertAll(ctx)
+}
+
+// PlanRollback returns the migrations Rollback would revert, with their SQL, without changing the database.
+func (m *Migrator) PlanRollback(ctx context.Context, n int) ([]Step, error) {
+	return m.runner.PlanRollback(ctx, n)
+}
+
+// PlanMigrateTo returns the migrations MigrateTo would revert and apply, with their SQL, without changing the database.
+func (m *Migrator) PlanMigrateTo(ctx context.Context, target string) ([]Step, error) {
+	return m.runner.PlanMigrateTo(ctx, target)
+}
+
+// Script writes a SQL script that applies (`up`) or reverts (`down`) the selected migrations, along with the
+// statements that update the migrations table. The database isn't queried.
+func (m *Migrator) Script(w io.Writer, direction string, opts ScriptOptions) error {
+	return m.runner.Script(w, direction, opts)
+}
+
+// Status returns the state of every migration in chronological order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	return m.runner.Status(ctx)
+}
+
+// Validate checks that the applied migrations haven't changed since they were applied. A *migration.ChecksumError
+// listing the changed migrations is returned if they have. Up and MigrateTo validate before running.
+func (m *Migrator) Validate(ctx context.Context) error {
+	return m.runner.Validate(ctx)
+}
+
+// Repair accepts changes to the applied migrations by updating their recorded checksums to match the migration files.
+// The updated migrations are returned.
+func (m *Migrator) Repair(ctx context.Context) ([]Mismatch, error) {
+	return m.runner.Repair(ctx)
+}
+
+// Lint checks the migrations for files that almost match the migration file pattern, missing or empty directions,
+// versions used by more than one migration, and pending migrations older than applied ones.
+func (m *Migrator) Lint(ctx context.Context) ([]LintIssue, error) {
+	return m.runner.Lint(ctx)
+}
+
+// DumpSchema writes the schema of the database, without the migrations table, followed by the IDs of the applied
+// migrations.
+func (m *Migrator) DumpSchema(ctx context.Context, w io.Writer) error {
+	return m.runner.DumpSchema(ctx, w)
+}
+
+// LoadSchema runs a schema written by DumpSchema in a database without applied migrations, and records its migrations
+// as applied.
+func (m *Migrator) LoadSchema(ctx context.Context, r io.Reader) ([]Result, error) {
+	return m.runner.LoadSchema(ctx, r)
+}
+
+// Unlock clears the migration lock, whichever process holds it. It should only be used to clear a stale lock.
+func (m *Migrator) Unlock(ctx context.Context) error {
+	return m.runner.Log.ForceUnlock(ctx)
 }
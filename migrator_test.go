@@ -0,0 +1,206 @@
+package turtle_test
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path"
+
+	// sqlite driver
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/nicday/turtle"
+	"github.com/nicday/turtle/config"
+	"github.com/nicday/turtle/migration"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migrator", func() {
+	var (
+		dir  string
+		conn *sql.DB
+		ctx  = context.Background()
+	)
+
+	fs := migration.NewMockFS()
+	fs.AddFiles(
+		"",
+		migration.NewMockFile("core", []byte(""),
+			migration.NewMockFile("20150703234300001_users_up.sql", []byte("CREATE TABLE users (id INTEGER)")),
+			migration.NewMockFile("20150703234300001_users_down.sql", []byte("DROP TABLE users")),
+			migration.NewMockFile("20150703234300002_teams_up.sql", []byte("CREATE TABLE teams (id INTEGER)")),
+			migration.NewMockFile("20150703234300002_teams_down.sql", []byte("DROP TABLE teams")),
+		),
+	)
+	fs.AddFiles(
+		"",
+		migration.NewMockFile("billing", []byte(""),
+			migration.NewMockFile("20150703234300001_invoices_up.sql", []byte("CREATE TABLE invoices (id INTEGER)")),
+			migration.NewMockFile("20150703234300001_invoices_down.sql", []byte("DROP TABLE invoices")),
+		),
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "turtle")
+		Expect(err).NotTo(HaveOccurred())
+
+		conn, err = sql.Open("sqlite3", path.Join(dir, "turtle.db"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		os.RemoveAll(dir)
+	})
+
+	// states returns the state of each migration, checking that applied migrations have a timestamp.
+	states := func(statuses []Status) map[string]migration.State {
+		m := map[string]migration.State{}
+		for _, s := range statuses {
+			Expect(s.AppliedAt.IsZero()).To(Equal(s.State == migration.StatePending))
+			m[s.ID] = s.State
+		}
+		return m
+	}
+
+	newMigrator := func(opts ...Option) *Migrator {
+		m, err := New(conn, fs, append([]Option{WithDialect("sqlite"), WithPath("core")}, opts...)...)
+		Expect(err).NotTo(HaveOccurred())
+		return m
+	}
+
+	Describe(".New", func() {
+		It("returns an error for an unknown dialect", func() {
+			_, err := New(conn, fs, WithDialect("oracle"))
+			Expect(err).To(Equal(config.ErrUnknownDBDriver))
+		})
+	})
+
+	Describe("#Up", func() {
+		It("applies all pending migrations", func() {
+			results, err := newMigrator().Up(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{
+				{ID: "20150703234300001_users", Direction: "up"},
+				{ID: "20150703234300002_teams", Direction: "up"},
+			}))
+
+			results, err = newMigrator().Up(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(BeEmpty())
+		})
+
+		It("returns the failing migration in the error", func() {
+			broken := migration.NewMockFS()
+			broken.AddFiles("", migration.NewMockFile("broken", []byte(""),
+				migration.NewMockFile("20150703234300001_broken_up.sql", []byte("CREATE TABLE")),
+			))
+
+			m, err := New(conn, broken, WithDialect("sqlite"), WithPath("broken"))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = m.Up(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*migration.Error).ID).To(Equal("20150703234300001_broken"))
+		})
+	})
+
+	Describe("#Down", func() {
+		It("reverts all applied migrations", func() {
+			_, err := newMigrator().Up(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err := newMigrator().Down(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{
+				{ID: "20150703234300002_teams", Direction: "down"},
+				{ID: "20150703234300001_users", Direction: "down"},
+			}))
+		})
+	})
+
+	Describe("#Rollback", func() {
+		It("reverts the latest n migrations", func() {
+			_, err := newMigrator().Up(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err := newMigrator().Rollback(ctx, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{
+				{ID: "20150703234300002_teams", Direction: "down"},
+			}))
+		})
+	})
+
+	Describe("#MigrateTo", func() {
+		It("applies and reverts migrations to reach the target", func() {
+			results, err := newMigrator().MigrateTo(ctx, "20150703234300001_users")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{
+				{ID: "20150703234300001_users", Direction: "up"},
+			}))
+
+			_, err = newMigrator().Up(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err = newMigrator().MigrateTo(ctx, "20150703234300001")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]Result{
+				{ID: "20150703234300002_teams", Direction: "down"},
+			}))
+		})
+	})
+
+	Describe("#Status", func() {
+		It("returns the state of each migration", func() {
+			_, err := newMigrator().Up(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = newMigrator().Rollback(ctx, 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			statuses, err := newMigrator().Status(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statuses).To(HaveLen(2))
+			Expect(states(statuses)).To(Equal(map[string]migration.State{
+				"20150703234300001_users": migration.StateApplied,
+				"20150703234300002_teams": migration.StatePending,
+			}))
+		})
+
+		It("reports applied migrations without files as missing", func() {
+			_, err := newMigrator().Up(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			statuses, err := newMigrator(WithPath("billing")).Status(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statuses[0].ID).To(Equal("20150703234300001_invoices"))
+			Expect(states(statuses)).To(Equal(map[string]migration.State{
+				"20150703234300001_invoices": migration.StatePending,
+				"20150703234300001_users":    migration.StateMissing,
+				"20150703234300002_teams":    migration.StateMissing,
+			}))
+		})
+	})
+
+	Context("with two migrators on one database", func() {
+		It("logs each set of migrations in its own table", func() {
+			core := newMigrator()
+			billing := newMigrator(WithPath("billing"), WithTableName("billing_migrations"))
+
+			_, err := core.Up(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			results, err := billing.Up(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+
+			statuses, err := billing.Status(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(states(statuses)).To(Equal(map[string]migration.State{
+				"20150703234300001_invoices": migration.StateApplied,
+			}))
+		})
+	})
+})
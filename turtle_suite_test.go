@@ -0,0 +1,13 @@
+package turtle_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTurtle(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Turtle Suite")
+}